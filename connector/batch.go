@@ -0,0 +1,95 @@
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ribGSilva/go-webconnector/request"
+	"strings"
+	"sync"
+)
+
+// ItemError is the error of one item of a batch
+type ItemError struct {
+	// Index is the position of the item in the batch
+	Index int
+	// Err is the error of the item
+	Err error
+}
+
+func (e ItemError) Error() string {
+	return fmt.Sprintf("item %d: %s", e.Index, e.Err.Error())
+}
+
+func (e ItemError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError aggregates the errors of the items of a batch, ordered by index
+// errors.Is and errors.As match against each of the item errors
+type MultiError struct {
+	Errors []ItemError
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, ie := range e.Errors {
+		msgs = append(msgs, ie.Error())
+	}
+	return fmt.Sprintf("connector: %d errors: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+func (e *MultiError) Is(target error) bool {
+	for _, ie := range e.Errors {
+		if errors.Is(ie.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *MultiError) As(target interface{}) bool {
+	for _, ie := range e.Errors {
+		if errors.As(ie.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// DoBatch executes concurrently one request to the path for each item of options
+// The responder must be safe for concurrent use
+// If any item fails, it returns a *MultiError with the errors of the failed items
+// Example:
+//		err := c.DoBatch("/users/:id", responder,
+//			[]request.Option{request.WithParam("id", 1)},
+//			[]request.Option{request.WithParam("id", 2)},
+//		)
+//		var multi *MultiError
+//		if errors.As(err, &multi) {
+//			for _, ie := range multi.Errors {
+//				log.Printf("user %d failed: %v", ie.Index, ie.Err)
+//			}
+//		}
+func (c Connector) DoBatch(path string, responder Responder, items ...[]request.Option) error {
+	errs := make([]error, len(items))
+	var wg sync.WaitGroup
+	for i, options := range items {
+		wg.Add(1)
+		go func(i int, options []request.Option) {
+			defer wg.Done()
+			errs[i] = c.DoBuild(path, responder, options...)
+		}(i, options)
+	}
+	wg.Wait()
+
+	var multi MultiError
+	for i, err := range errs {
+		if err != nil {
+			multi.Errors = append(multi.Errors, ItemError{Index: i, Err: err})
+		}
+	}
+	if len(multi.Errors) == 0 {
+		return nil
+	}
+	return &multi
+}
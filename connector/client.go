@@ -4,8 +4,23 @@
 package connector
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/ribGSilva/go-webconnector/request"
+	"github.com/ribGSilva/go-webconnector/response"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // WebClient is an interface that is able to performs http requests
@@ -28,8 +43,54 @@ type Connector struct {
 	generalOption []request.Option
 	// pathOptions contains the options to each endpoint mapping
 	pathOptions map[string][]request.Option
+	// pathMethods contains the locked http method of each endpoint
+	pathMethods map[string]request.HttpMethod
 	// webClient contains the client to perform the http request
 	webClient WebClient
+	// headerProvider supplies the base headers of each request
+	headerProvider func() http.Header
+	// flight coalesces concurrent identical GET requests
+	flight *flightGroup
+	// expectedContentType is the Content-Type all responses must have
+	expectedContentType string
+	// pageQuery is the query param incremented by Paginate
+	pageQuery string
+	// inFlight is the semaphore that limits the concurrent calls of Do
+	inFlight chan struct{}
+	// bodyMetrics receives the bytes read from each response body
+	bodyMetrics func(path string, bytesRead int64)
+	// retry tells when and how many times the requests are retried
+	retry *retryPolicy
+	// retryBudget limits the retries across all requests of the Connector
+	retryBudget *retryBudget
+	// retryBackoff is the wait before the first retry, doubled in each retry up to retryMaxBackoff
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+	// pathValidators contains the response validator of each endpoint
+	pathValidators map[string]func(status int, body []byte) error
+	// hostPool picks the host of each request, replacing host
+	hostPool *hostPool
+	// bufferResponses is the max size of the response bodies buffered before the retry check
+	bufferResponses int64
+	// responseHooks are called with every response, before the responder
+	responseHooks []func(*http.Response) error
+}
+
+// hostPool has the hosts a Connector distributes the requests across
+type hostPool struct {
+	hosts []string
+	pick  func([]string) string
+	// next is the round-robin position, used when pick is nil
+	next uint64
+}
+
+// host returns the host of the next request
+func (p *hostPool) host() string {
+	if p.pick != nil {
+		return p.pick(p.hosts)
+	}
+	n := atomic.AddUint64(&p.next, 1) - 1
+	return p.hosts[n%uint64(len(p.hosts))]
 }
 
 // New creates a new Connector
@@ -101,10 +162,15 @@ type Connector struct {
 //		}
 func New(host string, client WebClient, options ...Option) (Connector, error) {
 	c := Connector{
-		host:          host,
-		generalOption: make([]request.Option, 0),
-		pathOptions:   make(map[string][]request.Option),
-		webClient:     client,
+		host:            host,
+		generalOption:   make([]request.Option, 0),
+		pathOptions:     make(map[string][]request.Option),
+		pathMethods:     make(map[string]request.HttpMethod),
+		pathValidators:  make(map[string]func(status int, body []byte) error),
+		webClient:       client,
+		pageQuery:       "page",
+		retryBackoff:    defaultRetryBackoff,
+		retryMaxBackoff: defaultRetryMaxBackoff,
 	}
 
 	for _, o := range options {
@@ -116,6 +182,41 @@ func New(host string, client WebClient, options ...Option) (Connector, error) {
 	return c, nil
 }
 
+// With creates a copy of the Connector with the options applied on top
+// The original Connector is not changed
+// Example:
+//		base, _ := New("my.host.com", http.DefaultClient, WithGeneral(request.WithHeader("Authorization", token)))
+//		users, _ := base.With(WithPath("/users"))
+func (c Connector) With(options ...Option) (Connector, error) {
+	derived := c.clone()
+	for _, o := range options {
+		if err := o(&derived); err != nil {
+			return Connector{}, err
+		}
+	}
+	return derived, nil
+}
+
+// clone copies the Connector, without sharing its slices and maps
+func (c Connector) clone() Connector {
+	derived := c
+	derived.generalOption = append([]request.Option{}, c.generalOption...)
+	derived.pathOptions = make(map[string][]request.Option, len(c.pathOptions))
+	for k, v := range c.pathOptions {
+		derived.pathOptions[k] = append([]request.Option{}, v...)
+	}
+	derived.pathMethods = make(map[string]request.HttpMethod, len(c.pathMethods))
+	for k, v := range c.pathMethods {
+		derived.pathMethods[k] = v
+	}
+	derived.responseHooks = append([]func(*http.Response) error{}, c.responseHooks...)
+	derived.pathValidators = make(map[string]func(status int, body []byte) error, len(c.pathValidators))
+	for k, v := range c.pathValidators {
+		derived.pathValidators[k] = v
+	}
+	return derived
+}
+
 // Option add optional values to the Connector
 type Option func(*Connector) error
 
@@ -127,6 +228,235 @@ func WithGeneral(o ...request.Option) Option {
 	}
 }
 
+// WithQueryStruct adds to all requests the query params from a struct with url tags
+// The params can be overridden in each call with request.WithSetQuery
+func WithQueryStruct(v interface{}) Option {
+	return func(c *Connector) error {
+		c.generalOption = append(c.generalOption, request.WithQueryStruct(v))
+		return nil
+	}
+}
+
+// WithDefaultQuery adds to all requests the query param
+// The param can be overridden in each call with request.WithSetQuery
+// Example:
+//			WithDefaultQuery("api_version", 2)
+func WithDefaultQuery(key string, value interface{}) Option {
+	return func(c *Connector) error {
+		c.generalOption = append(c.generalOption, request.WithSetQuery(key, value))
+		return nil
+	}
+}
+
+// WithDefaultQueries adds to all requests the query params, in the order of the sorted keys
+// The params can be overridden in each call with request.WithSetQuery
+func WithDefaultQueries(queries map[string]interface{}) Option {
+	return func(c *Connector) error {
+		keys := make([]string, 0, len(queries))
+		for k := range queries {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			c.generalOption = append(c.generalOption, request.WithSetQuery(k, queries[k]))
+		}
+		return nil
+	}
+}
+
+// WithRequireHTTPS makes all requests fail if the url scheme is not https
+func WithRequireHTTPS() Option {
+	return func(c *Connector) error {
+		c.generalOption = append(c.generalOption, request.RequireHTTPS())
+		return nil
+	}
+}
+
+// WithHostPool distributes the requests across the hosts, replacing the host of the Connector
+// pick chooses the host of each request, when nil the hosts are picked round-robin
+// Example:
+//			WithHostPool([]string{"node1.my.host.com", "node2.my.host.com"}, nil)
+func WithHostPool(hosts []string, pick func([]string) string) Option {
+	return func(c *Connector) error {
+		if len(hosts) == 0 {
+			return errors.New("connector: host pool without hosts")
+		}
+		c.hostPool = &hostPool{hosts: append([]string{}, hosts...), pick: pick}
+		return nil
+	}
+}
+
+// WithRoundTripper replaces the webClient with one that sends the requests directly with rt
+// It allows wrapping the transport for tracing, mocking or recording without building a http.Client
+// As a RoundTripper, the redirects are not followed and cookies are not handled
+// Example:
+//			WithRoundTripper(otelhttp.NewTransport(http.DefaultTransport))
+func WithRoundTripper(rt http.RoundTripper) Option {
+	return func(c *Connector) error {
+		c.webClient = roundTripperClient{rt: rt}
+		return nil
+	}
+}
+
+// roundTripperClient adapts a http.RoundTripper to the WebClient interface
+type roundTripperClient struct {
+	rt http.RoundTripper
+}
+
+func (r roundTripperClient) Do(req *http.Request) (*http.Response, error) {
+	return r.rt.RoundTrip(req)
+}
+
+// WithTraceParent generates in each request a W3C traceparent header, when it has none
+// A trace can be propagated in each call with request.TraceParent
+func WithTraceParent() Option {
+	return func(c *Connector) error {
+		c.generalOption = append(c.generalOption, request.AutoTraceParent())
+		return nil
+	}
+}
+
+// WithHeaderProvider sets a function called in each Do to supply base headers
+// The headers already present in the request take precedence over the provided ones
+// Example:
+//			WithHeaderProvider(func() http.Header {
+//				return http.Header{"Authorization": {"Bearer " + tokens.Current()}}
+//			})
+func WithHeaderProvider(provider func() http.Header) Option {
+	return func(c *Connector) error {
+		c.headerProvider = provider
+		return nil
+	}
+}
+
+// WithSingleFlight makes concurrent GET requests to the same url share one call
+// Each caller receives its own copy of the response, with the body buffered
+// Only the requests with the same headers share a call, so different credentials never share a response
+func WithSingleFlight() Option {
+	return func(c *Connector) error {
+		c.flight = newFlightGroup()
+		return nil
+	}
+}
+
+// WithExpectedContentType makes Do return an error when the response Content-Type does not contain ct
+// It catches, for example, an html error page where a json was expected, before the responder runs
+// The redirects and the responses without body, like 204, 304 or the ones of HEAD, are not checked
+func WithExpectedContentType(ct string) Option {
+	return func(c *Connector) error {
+		c.expectedContentType = ct
+		return nil
+	}
+}
+
+// WithPageQuery sets the query param incremented by Paginate
+// By default it is "page"
+func WithPageQuery(name string) Option {
+	return func(c *Connector) error {
+		c.pageQuery = name
+		return nil
+	}
+}
+
+// WithMaxInFlight limits to n the concurrent calls of Do
+// When the limit is reached, Do waits for a slot or for the request context to be done
+func WithMaxInFlight(n int) Option {
+	return func(c *Connector) error {
+		if n < 1 {
+			return fmt.Errorf("connector: max in flight must be positive, got %d", n)
+		}
+		c.inFlight = make(chan struct{}, n)
+		return nil
+	}
+}
+
+// WithBodyMetrics sets a function that receives how many bytes the responder read from each response body
+// The path is the one given to DoBuild, or the url path when using Do
+func WithBodyMetrics(f func(path string, bytesRead int64)) Option {
+	return func(c *Connector) error {
+		c.bodyMetrics = f
+		return nil
+	}
+}
+
+// WithRetry retries up to maxRetries times the requests when retryable returns true
+// A request with a body is only retried if the body can be replayed with GetBody
+// The retries wait an exponential backoff with jitter, from 100ms up to 2s, see WithRetryBackoff
+// Example:
+//			WithRetry(3, func(res *http.Response, err error) bool {
+//				return err != nil || res.StatusCode == http.StatusServiceUnavailable
+//			})
+func WithRetry(maxRetries int, retryable func(*http.Response, error) bool) Option {
+	return func(c *Connector) error {
+		c.retry = &retryPolicy{maxRetries: maxRetries, retryable: retryable}
+		return nil
+	}
+}
+
+// WithRetryBudget limits the retries across all requests, avoiding retry storms
+// In each window of 10 seconds, the retries are limited to minPerSec per second
+// plus the ratio of the requests made in the window
+// When the budget is exhausted, the retryable results are returned without retry
+// Example:
+//			WithRetryBudget(0.2, 1) // 10 retries plus 20% of the requests in each window
+func WithRetryBudget(ratio float64, minPerSec int) Option {
+	return func(c *Connector) error {
+		c.retryBudget = newRetryBudget(ratio, minPerSec)
+		return nil
+	}
+}
+
+// WithRetryBackoff sets the wait between the retries of WithRetry
+// The wait before the first retry is about base, and it doubles in each retry up to max
+// Half of each wait is random, so the retries of concurrent requests do not hit the server at once
+// The wait stops when the context of the request is done
+// Example:
+//			WithRetryBackoff(200*time.Millisecond, 5*time.Second)
+func WithRetryBackoff(base, max time.Duration) Option {
+	return func(c *Connector) error {
+		if base <= 0 || max < base {
+			return fmt.Errorf("connector: retry backoff must be positive and not above max, got %s and %s", base, max)
+		}
+		c.retryBackoff = base
+		c.retryMaxBackoff = max
+		return nil
+	}
+}
+
+// WithBufferResponses buffers the response bodies up to maxBytes as soon as they are received
+// The retry predicate of WithRetry can read the body, and the responder still reads it from the start
+// Bigger bodies are not buffered, and are consumed if the predicate reads them
+// Example:
+//			WithBufferResponses(64 << 10),
+//			WithRetry(3, func(res *http.Response, err error) bool {
+//				var apiErr ApiError
+//				return err == nil && json.NewDecoder(res.Body).Decode(&apiErr) == nil && apiErr.Code == "TRY_AGAIN"
+//			})
+func WithBufferResponses(maxBytes int64) Option {
+	return func(c *Connector) error {
+		if maxBytes < 1 {
+			return fmt.Errorf("connector: buffer responses max bytes must be positive, got %d", maxBytes)
+		}
+		c.bufferResponses = maxBytes
+		return nil
+	}
+}
+
+// WithResponseHook adds a function called with every response, of any status, before the responder
+// If it returns an error, the responder is not called and the error is returned
+// The hooks are called in the order they were added
+// Example:
+//			WithResponseHook(func(res *http.Response) error {
+//				remaining.Store(res.Header.Get("X-RateLimit-Remaining"))
+//				return nil
+//			})
+func WithResponseHook(hook func(*http.Response) error) Option {
+	return func(c *Connector) error {
+		c.responseHooks = append(c.responseHooks, hook)
+		return nil
+	}
+}
+
 // WithPath sets a path to the Connector
 func WithPath(path string, o ...request.Option) Option {
 	return func(c *Connector) error {
@@ -143,10 +473,53 @@ func WithPaths(po map[string][]request.Option) Option {
 	}
 }
 
+// WithPathMethod locks the http method of a path
+// DoBuild returns an error if the options of a call change the method of that path
+// Example:
+//			WithPathMethod("/users/:id", request.MethodGet)
+func WithPathMethod(path string, method request.HttpMethod) Option {
+	return func(c *Connector) error {
+		c.pathMethods[path] = method
+		return nil
+	}
+}
+
+// WithResponseValidator validates the responses of a path before the responder runs
+// The body is buffered for the validation, and the responder reads it again
+// If validate returns an error, the responder is not called and the error is returned
+// Example:
+//			WithResponseValidator("/users/:id", func(status int, body []byte) error {
+//				if status == 200 && !json.Valid(body) {
+//					return errors.New("invalid user json")
+//				}
+//				return nil
+//			})
+func WithResponseValidator(path string, validate func(status int, body []byte) error) Option {
+	return func(c *Connector) error {
+		c.pathValidators[path] = validate
+		return nil
+	}
+}
+
 // DoBuild builds the request accordingly to the options and executes it
 // the options are applied in the order: general -> pathDefaults -> custom
+// The errors are returned as a *ConnectorError with the path and method
 func (c Connector) DoBuild(path string, responder Responder, options ...request.Option) error {
+	req, method, err := c.build(path, options...)
+	if err != nil {
+		return &ConnectorError{Path: path, Method: method, Err: err}
+	}
+	defer request.Release(req)
 
+	if err := c.do(path, req, responder); err != nil {
+		return &ConnectorError{Path: path, Method: req.Method, Err: err}
+	}
+	return nil
+}
+
+// build builds the request of the path, applying the options in the order: general -> pathDefaults -> custom
+// It also returns the method of the request, or when the build fails, the method set by the options applied until then
+func (c Connector) build(path string, options ...request.Option) (*http.Request, string, error) {
 	reqOptions := []request.Option{request.WithPath(path)}
 	reqOptions = append(reqOptions, c.generalOption...)
 
@@ -155,21 +528,444 @@ func (c Connector) DoBuild(path string, responder Responder, options ...request.
 		reqOptions = append(reqOptions, pathDefaultOption...)
 	}
 
+	lockedMethod, locked := c.pathMethods[path]
+	if locked {
+		reqOptions = append(reqOptions, request.WithMethod(lockedMethod))
+	}
+
 	reqOptions = append(reqOptions, options...)
 
-	req, err := request.New(c.host, reqOptions...)
+	host := c.host
+	if c.hostPool != nil {
+		host = c.hostPool.host()
+	}
+
+	b, err := request.NewBuilder(host)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := b.Apply(reqOptions...); err != nil {
+		return nil, string(b.Method()), err
+	}
+	req, err := b.Build()
+	if err != nil {
+		return nil, string(b.Method()), err
+	}
+
+	if locked && req.Method != string(lockedMethod) {
+		return nil, req.Method, fmt.Errorf("connector: path %s is locked to method %s, got %s", path, lockedMethod, req.Method)
+	}
+
+	if c.flight != nil {
+		if key, err := b.CacheKey(); err == nil {
+			req = withFlightKey(req, key)
+		}
+	}
+
+	return req, req.Method, nil
+}
+
+// DoFollow builds the request, executes it and follows up to maxRedirects redirects before triggering the responder
+// The redirects are followed with GET, except 307 and 308 that keep the method and the body
+// It is meant to be used with a client that does not follow redirects, and returns an error when the limit is exceeded
+func (c Connector) DoFollow(path string, responder Responder, maxRedirects int, options ...request.Option) error {
+	req, _, err := c.build(path, options...)
 	if err != nil {
 		return err
 	}
+	defer request.Release(req)
+
+	for redirects := 0; ; redirects++ {
+		var location *url.URL
+		status := 0
+		follow := responderFunc(func(res *http.Response) error {
+			if res == nil || res.StatusCode < 300 || res.StatusCode > 399 || res.Header.Get("Location") == "" {
+				return responder.Respond(res)
+			}
+			if redirects >= maxRedirects {
+				return fmt.Errorf("connector: stopped after %d redirects", maxRedirects)
+			}
+			var err error
+			if location, err = req.URL.Parse(res.Header.Get("Location")); err != nil {
+				return err
+			}
+			status = res.StatusCode
+			if res.Body != nil {
+				_, _ = io.Copy(ioutil.Discard, res.Body)
+				_ = res.Body.Close()
+			}
+			return nil
+		})
+
+		if err := c.do(path, req, follow); err != nil {
+			return err
+		}
+		if location == nil {
+			return nil
+		}
+		if req, err = redirectRequest(req, location, status); err != nil {
+			return err
+		}
+	}
+}
+
+// redirectRequest creates the request to follow a redirect
+func redirectRequest(req *http.Request, location *url.URL, status int) (*http.Request, error) {
+	// the flight key of the first request is dropped, so the hop is coalesced by its own method and url
+	next := req.Clone(context.WithValue(req.Context(), flightKeyContext{}, nil))
+	next.URL = location
+	next.Host = ""
+	if location.Host != req.URL.Host {
+		next.Header.Del("Authorization")
+	}
+
+	if status == http.StatusTemporaryRedirect || status == http.StatusPermanentRedirect {
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			next.Body = body
+		} else if req.Body != nil && req.Body != http.NoBody {
+			return nil, fmt.Errorf("connector: can not replay the body to follow the redirect to %s", location)
+		}
+		return next, nil
+	}
+
+	next.Method = http.MethodGet
+	next.Body = nil
+	next.GetBody = nil
+	next.ContentLength = 0
+	next.Header.Del("Content-Type")
+	return next, nil
+}
 
-	return c.Do(req, responder)
+// DoStatus works like DoBuild, also returning the status code of the response
+// The status is 0 when no response was received
+func (c Connector) DoStatus(path string, responder Responder, options ...request.Option) (int, error) {
+	status := 0
+	capture := responderFunc(func(res *http.Response) error {
+		if res != nil {
+			status = res.StatusCode
+		}
+		return responder.Respond(res)
+	})
+	err := c.DoBuild(path, capture, options...)
+	return status, err
+}
+
+// Ping sends a GET to the path, with the general and path options, for health and readiness checks
+// The method is always GET and the request has no body, even when the path options set others
+// It returns nil for a 2xx status, and an error otherwise
+// Example:
+//		if err := c.Ping(ctx, "/health"); err != nil {
+//			return fmt.Errorf("users api not ready: %w", err)
+//		}
+func (c Connector) Ping(ctx context.Context, path string) error {
+	check := responderFunc(func(res *http.Response) error {
+		if res == nil {
+			return fmt.Errorf("connector: ping %s without response", path)
+		}
+		if res.Body != nil {
+			defer res.Body.Close()
+		}
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return fmt.Errorf("connector: ping %s unexpected status %d", path, res.StatusCode)
+		}
+		return nil
+	})
+	return c.DoBuild(path, check, request.WithContext(ctx), request.WithMethod(request.MethodGet), request.WithBody(nil))
 }
 
 // Do should execute the request and triggers the responder
 func (c Connector) Do(request *http.Request, responder Responder) error {
-	if res, err := c.webClient.Do(request); err != nil {
+	return c.do(request.URL.Path, request, responder)
+}
+
+// do executes the request of the path and triggers the responder
+func (c Connector) do(path string, request *http.Request, responder Responder) error {
+	res, done, err := c.exchange(path, request)
+	if err != nil {
 		return err
-	} else {
-		return responder.Respond(res)
 	}
+	defer done()
+
+	return responder.Respond(res)
+}
+
+// exchange executes the request of the path, with all the steps of do before the responder:
+// the in-flight limit, the provided headers, the elapsed time, the response hooks,
+// the expected content type, the response validator and the body metrics
+// When there is no error, done must be called after the response is consumed,
+// to release the in-flight slot and report the body metrics
+func (c Connector) exchange(path string, req *http.Request) (res *http.Response, done func(), err error) {
+	var release []func()
+	finish := func() {
+		for i := len(release) - 1; i >= 0; i-- {
+			release[i]()
+		}
+	}
+	defer func() {
+		if err != nil {
+			finish()
+		}
+	}()
+
+	if c.inFlight != nil {
+		select {
+		case c.inFlight <- struct{}{}:
+			release = append(release, func() { <-c.inFlight })
+		case <-req.Context().Done():
+			return nil, nil, req.Context().Err()
+		}
+	}
+
+	c.provideHeaders(req)
+
+	start := time.Now()
+	res, err = c.send(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res != nil {
+		sent := res.Request
+		if sent == nil {
+			sent = req
+		}
+		res.Request = sent.WithContext(response.ContextWithElapsed(sent.Context(), time.Since(start)))
+		for _, hook := range c.responseHooks {
+			if err := hook(res); err != nil {
+				discardBody(res)
+				return nil, nil, err
+			}
+		}
+	}
+
+	if c.expectedContentType != "" && res != nil && res.StatusCode/100 != 3 && hasBody(res) {
+		if ct := res.Header.Get("Content-Type"); !strings.Contains(ct, c.expectedContentType) {
+			discardBody(res)
+			return nil, nil, fmt.Errorf("connector: expected content type %s, got %q", c.expectedContentType, ct)
+		}
+	}
+
+	if validate, ok := c.pathValidators[path]; ok && res != nil {
+		if err := validateResponse(res, validate); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if c.bodyMetrics != nil && res != nil && res.Body != nil {
+		counter := &countingReadCloser{ReadCloser: res.Body}
+		res.Body = counter
+		release = append(release, func() { c.bodyMetrics(path, counter.n) })
+	}
+
+	return res, finish, nil
+}
+
+// hasBody tells if the response may have a body
+// The 204 and 304 responses, the responses of HEAD and the ones with ContentLength 0 have none
+func hasBody(res *http.Response) bool {
+	if res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotModified || res.ContentLength == 0 {
+		return false
+	}
+	return res.Request == nil || res.Request.Method != http.MethodHead
+}
+
+// discardBody drains and closes the body of a response that is not given to the responder,
+// so the client can reuse the connection
+func discardBody(res *http.Response) {
+	if res.Body != nil {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+	}
+}
+
+// validateResponse buffers the body for the validation, leaving it to be read again
+func validateResponse(res *http.Response, validate func(status int, body []byte) error) error {
+	var body []byte
+	if res.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if err != nil {
+			return err
+		}
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return validate(res.StatusCode, body)
+}
+
+// provideHeaders adds the headers of the headerProvider missing in the request
+func (c Connector) provideHeaders(req *http.Request) {
+	if c.headerProvider == nil {
+		return
+	}
+	for k, v := range c.headerProvider() {
+		if req.Header.Get(k) == "" {
+			req.Header[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+}
+
+// Stream builds the request, executes it and returns the response without running a responder
+// It runs the same steps of DoBuild before the responder, like the in-flight limit and the response hooks
+// The caller owns the response and must close its body, which releases the in-flight slot
+// Example:
+//		res, err := c.Stream("/export")
+//		if err != nil {
+//			return err
+//		}
+//		defer res.Body.Close()
+//		_, err = io.Copy(w, res.Body)
+func (c Connector) Stream(path string, options ...request.Option) (*http.Response, error) {
+	req, _, err := c.build(path, options...)
+	if err != nil {
+		return nil, err
+	}
+	res, done, err := c.exchange(path, req)
+	if err != nil {
+		request.Release(req)
+		return nil, err
+	}
+	finish := func() {
+		done()
+		request.Release(req)
+	}
+	if res == nil || res.Body == nil {
+		finish()
+		return res, nil
+	}
+	res.Body = &onCloseBody{ReadCloser: res.Body, onClose: finish}
+	return res, nil
+}
+
+// onCloseBody calls onClose once, when the body is closed
+type onCloseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	onClose func()
+}
+
+func (b *onCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.onClose)
+	return err
+}
+
+// countingReadCloser counts the bytes read from the body
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// send executes the request with the webClient
+func (c Connector) send(req *http.Request) (*http.Response, error) {
+	if c.flight != nil && req.Method == http.MethodGet {
+		return c.flight.do(req.Context(), flightKey(req), func() (*http.Response, error) {
+			return c.doWithRetry(req)
+		})
+	}
+	return c.doWithRetry(req)
+}
+
+// Download builds the request and streams a 200 response body into the file at filePath
+// The file is created or truncated, and it is removed if anything fails
+func (c Connector) Download(path, filePath string, options ...request.Option) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	responder, err := response.NewResponder(
+		response.ForWriter(http.StatusOK, f),
+		response.ForDefault(func(r response.Response) error {
+			return fmt.Errorf("connector: download failed with status %d", r.HttpResponse.StatusCode)
+		}),
+	)
+	if err == nil {
+		err = c.DoBuild(path, &responder, options...)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(filePath)
+		return err
+	}
+	return nil
+}
+
+// responderFunc adapts a function to the Responder interface
+type responderFunc func(*http.Response) error
+
+func (f responderFunc) Respond(res *http.Response) error {
+	return f(res)
+}
+
+// Paginate requests the pages of the path, starting from 1, until next returns false
+// The page is sent in the page query param, configured by WithPageQuery
+// It stops with the context error when ctx is done
+// The body of each page is drained and closed after next returns, so next does not close it
+// Example:
+//		err := c.Paginate(ctx, "/users", func(page int, resp *http.Response) (bool, error) {
+//			var users []User
+//			if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+//				return false, err
+//			}
+//			all = append(all, users...)
+//			return len(users) > 0, nil
+//		})
+func (c Connector) Paginate(ctx context.Context, path string, next func(page int, resp *http.Response) (more bool, err error), options ...request.Option) error {
+	for page := 1; ; page++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		more := false
+		responder := responderFunc(func(res *http.Response) error {
+			if res != nil {
+				defer discardBody(res)
+			}
+			var err error
+			more, err = next(page, res)
+			return err
+		})
+
+		pageOptions := append([]request.Option{}, options...)
+		pageOptions = append(pageOptions, request.WithContext(ctx), request.WithSetQuery(c.pageQuery, page))
+		if err := c.DoBuild(path, responder, pageOptions...); err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// DoJson builds the request, executes it and decodes a 2xx json body into a T
+// Any other status returns an error
+// Example:
+//		user, err := DoJson[User](c, "/users/:id", request.WithParam("id", 123))
+func DoJson[T any](c Connector, path string, options ...request.Option) (T, error) {
+	var v T
+	responder, err := response.NewResponder(
+		response.ForDefault(func(r response.Response) error {
+			if r.HttpResponse.StatusCode < 200 || r.HttpResponse.StatusCode > 299 {
+				return fmt.Errorf("connector: unexpected status %d", r.HttpResponse.StatusCode)
+			}
+			return json.NewDecoder(r.HttpResponse.Body).Decode(&v)
+		}),
+	)
+	if err != nil {
+		return v, err
+	}
+	err = c.DoBuild(path, &responder, options...)
+	return v, err
 }
@@ -1,10 +1,25 @@
 package connector
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/ribGSilva/go-webconnector/request"
+	"github.com/ribGSilva/go-webconnector/response"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 const host = "defaultHost"
@@ -17,6 +32,433 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewDefaultQuery(t *testing.T) {
+	client := &mockWebClient{expectedUrl: "http://" + host + "/items?api_version=1&lang=en", expectedMethod: "GET"}
+	c, err := New(host, client, WithDefaultQuery("api_version", 1), WithDefaultQueries(map[string]interface{}{"lang": "en"}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := c.DoBuild("/items", &mockResponder{}); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	client.expectedUrl = "http://" + host + "/items?api_version=2&lang=en"
+	if err := c.DoBuild("/items", &mockResponder{}, request.WithSetQuery("api_version", 2)); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+func TestResponseValidator(t *testing.T) {
+	reqGet := "/users/:id"
+	errInvalid := errors.New("invalid json")
+	client := &mockWebClient{resp: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"name":`))}}
+	c, err := New(host, client, WithResponseValidator(reqGet, func(status int, body []byte) error {
+		if !json.Valid(body) {
+			return errInvalid
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	called := false
+	responder := responderFunc(func(*http.Response) error {
+		called = true
+		return nil
+	})
+	if err := c.DoBuild(reqGet, responder, request.WithParam("id", 1)); !errors.Is(err, errInvalid) {
+		t.Errorf("error does not match: expected %s, result: %v", errInvalid, err)
+		t.FailNow()
+	}
+	if called {
+		t.Error("responder should not be called")
+		t.FailNow()
+	}
+}
+
+func TestResponseValidatorValid(t *testing.T) {
+	reqGet := "/users/:id"
+	client := &mockWebClient{resp: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"name":"a"}`))}}
+	c, err := New(host, client, WithResponseValidator(reqGet, func(status int, body []byte) error {
+		if !json.Valid(body) {
+			return errors.New("invalid json")
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	var body string
+	responder, _ := response.NewResponder(response.ForString(200, &body))
+	if err := c.DoBuild(reqGet, &responder, request.WithParam("id", 1)); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if body != `{"name":"a"}` {
+		t.Errorf("body does not match: expected %s, result: %s", `{"name":"a"}`, body)
+		t.FailNow()
+	}
+}
+
+func TestRoundTripper(t *testing.T) {
+	reqGet := "/get-endpoint"
+	c, err := New(host, &mockWebClient{err: errors.New("client should not be used")}, WithRoundTripper(taggingRoundTripper{}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	var tag string
+	responder := responderFunc(func(res *http.Response) error {
+		tag = res.Header.Get("X-Tag")
+		return nil
+	})
+	if err := c.DoBuild(reqGet, responder); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if tag != "GET "+reqGet {
+		t.Errorf("tag does not match: expected %s, result: %s", "GET "+reqGet, tag)
+		t.FailNow()
+	}
+}
+
+// taggingRoundTripper tags the responses with the method and path of the request
+type taggingRoundTripper struct{}
+
+func (taggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: 200, Header: http.Header{"X-Tag": {req.Method + " " + req.URL.Path}}, Request: req}, nil
+}
+
+func TestSLA(t *testing.T) {
+	reqGet := "/get-endpoint"
+	c, err := New(host, &slowWebClient{delay: 20 * time.Millisecond})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	var breach time.Duration
+	responder, _ := response.NewResponder(
+		response.WithSLA(10*time.Millisecond, func(d time.Duration) { breach = d }),
+		response.ForStatus(200),
+	)
+	if err := c.DoBuild(reqGet, &responder); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if breach < 20*time.Millisecond {
+		t.Errorf("breach does not match: expected at least %s, result: %s", 20*time.Millisecond, breach)
+		t.FailNow()
+	}
+}
+
+// slowWebClient responds 200 after the delay
+type slowWebClient struct {
+	delay time.Duration
+}
+
+func (m *slowWebClient) Do(*http.Request) (*http.Response, error) {
+	time.Sleep(m.delay)
+	return &http.Response{StatusCode: 200}, nil
+}
+
+func TestPing(t *testing.T) {
+	client := &mockWebClient{expectedUrl: "http://" + host + "/health", expectedMethod: "GET", resp: &http.Response{StatusCode: 200}}
+	c, err := New(host, client)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := c.Ping(context.Background(), "/health"); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+func TestPingPathMethod(t *testing.T) {
+	client := &mockWebClient{expectedUrl: "http://" + host + "/health", expectedMethod: "GET", resp: &http.Response{StatusCode: 200}}
+	c, err := New(host, client, WithPath("/health", request.WithMethod(request.MethodPost), request.WithString("check")))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := c.Ping(context.Background(), "/health"); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if client.lastReq.Body != nil && client.lastReq.Body != http.NoBody {
+		t.Error("body supposed to be empty")
+		t.FailNow()
+	}
+}
+
+func TestPingPathBodyFunc(t *testing.T) {
+	client := &mockWebClient{expectedUrl: "http://" + host + "/health", expectedMethod: "GET", resp: &http.Response{StatusCode: 200}}
+	c, err := New(host, client, WithPath("/health", request.BodyFunc(func() (interface{}, error) {
+		return map[string]string{"check": "deep"}, nil
+	})))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := c.Ping(context.Background(), "/health"); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if client.lastReq.Body != nil && client.lastReq.Body != http.NoBody {
+		t.Error("body supposed to be empty")
+		t.FailNow()
+	}
+}
+
+func TestPingError(t *testing.T) {
+	client := &mockWebClient{resp: &http.Response{StatusCode: 503, Body: ioutil.NopCloser(bytes.NewBufferString("unavailable"))}}
+	c, err := New(host, client)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := c.Ping(context.Background(), "/health"); err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestHostPool(t *testing.T) {
+	client := &mockWebClient{}
+	calls := 0
+	pick := func(hosts []string) string {
+		h := hosts[calls%len(hosts)]
+		calls++
+		return h
+	}
+	c, err := New(host, client, WithHostPool([]string{"node1", "node2"}, pick))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	for _, expected := range []string{"node1", "node2", "node1"} {
+		if err := c.DoBuild("/items", &mockResponder{}); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if client.lastReq.URL.Host != expected {
+			t.Errorf("host does not match: expected %s, result: %s", expected, client.lastReq.URL.Host)
+			t.FailNow()
+		}
+	}
+}
+
+func TestHostPoolRoundRobin(t *testing.T) {
+	client := &mockWebClient{}
+	c, err := New(host, client, WithHostPool([]string{"node1", "node2"}, nil))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	for _, expected := range []string{"node1", "node2", "node1"} {
+		if err := c.DoBuild("/items", &mockResponder{}); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if client.lastReq.URL.Host != expected {
+			t.Errorf("host does not match: expected %s, result: %s", expected, client.lastReq.URL.Host)
+			t.FailNow()
+		}
+	}
+}
+
+func TestHostPoolErr(t *testing.T) {
+	_, err := New(host, &mockWebClient{}, WithHostPool(nil, nil))
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestConnectorError(t *testing.T) {
+	mockedErr := errors.New("mocked error")
+	c, err := New(host, &mockWebClient{resp: &http.Response{StatusCode: 200}})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild("/users/:id", &mockResponder{err: mockedErr}, request.WithParam("id", 1), request.WithMethod(request.MethodDelete))
+	var connErr *ConnectorError
+	if !errors.As(err, &connErr) {
+		t.Errorf("error does not match: expected %T, result: %v", connErr, err)
+		t.FailNow()
+	}
+	expected := "connector: DELETE /users/:id: mocked error"
+	if err.Error() != expected {
+		t.Errorf("error message does not match: expected %s, result: %s", expected, err.Error())
+		t.FailNow()
+	}
+	if errors.Unwrap(err) != mockedErr {
+		t.Errorf("cause does not match: expected %v, result: %v", mockedErr, errors.Unwrap(err))
+		t.FailNow()
+	}
+}
+
+func TestConnectorErrorBuildMethod(t *testing.T) {
+	c, err := New(host, &mockWebClient{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild("/x", &mockResponder{},
+		request.WithMethod(request.MethodPost),
+		request.RequireHeader("X-Tenant"))
+	var connErr *ConnectorError
+	if !errors.As(err, &connErr) || connErr.Method != "POST" {
+		t.Errorf("error does not match: expected POST %s, result: %v", "/x", err)
+		t.FailNow()
+	}
+}
+
+func TestConnectorErrorOptionMethod(t *testing.T) {
+	c, err := New(host, &mockWebClient{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	mockedErr := errors.New("mocked error")
+	calls := 0
+	err = c.DoBuild("/x", &mockResponder{},
+		request.WithMethod(request.MethodPost),
+		request.WithMultipart(func(w *multipart.Writer) error {
+			calls++
+			return mockedErr
+		}))
+	var connErr *ConnectorError
+	if !errors.As(err, &connErr) || connErr.Method != "POST" {
+		t.Errorf("error does not match: expected POST %s, result: %v", "/x", err)
+		t.FailNow()
+	}
+	if calls != 1 {
+		t.Errorf("calls does not match: expected %d, result: %d", 1, calls)
+		t.FailNow()
+	}
+}
+
+func TestConnectorErrorBuild(t *testing.T) {
+	c, err := New(host, &mockWebClient{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild("/users/:id", &mockResponder{})
+	var connErr *ConnectorError
+	if !errors.As(err, &connErr) || connErr.Path != "/users/:id" || connErr.Method != "GET" {
+		t.Errorf("error does not match: expected GET %s, result: %v", "/users/:id", err)
+		t.FailNow()
+	}
+	if !errors.Is(err, request.ErrUnresolvedParam) {
+		t.Errorf("error does not match: expected %s, result: %v", request.ErrUnresolvedParam, err)
+		t.FailNow()
+	}
+}
+
+func TestTraceParent(t *testing.T) {
+	client := &mockWebClient{}
+	c, err := New(host, client, WithTraceParent())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := c.DoBuild("/items", &mockResponder{}); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	first := client.lastReq.Header.Get("traceparent")
+	if err := c.DoBuild("/items", &mockResponder{}); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	second := client.lastReq.Header.Get("traceparent")
+	if len(first) != 55 || first == second {
+		t.Errorf("traceparent should be generated in each call: first %s, second: %s", first, second)
+		t.FailNow()
+	}
+}
+
+func TestResponseHook(t *testing.T) {
+	header := http.Header{"X-Ratelimit-Remaining": {"42"}}
+	c, err := New(host, &mockWebClient{resp: &http.Response{StatusCode: 200, Header: header}})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	remaining := ""
+	c, err = c.With(WithResponseHook(func(res *http.Response) error {
+		remaining = res.Header.Get("X-RateLimit-Remaining")
+		return nil
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := c.DoBuild("/items", &mockResponder{}); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if remaining != "42" {
+		t.Errorf("remaining does not match: expected %s, result: %s", "42", remaining)
+		t.FailNow()
+	}
+}
+
+func TestResponseHookError(t *testing.T) {
+	errPayment := errors.New("payment required")
+	body := &closeTrackingBody{Reader: strings.NewReader("payment required")}
+	c, err := New(host, &mockWebClient{resp: &http.Response{StatusCode: 402, Body: body}}, WithResponseHook(func(res *http.Response) error {
+		if res.StatusCode == http.StatusPaymentRequired {
+			return errPayment
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	called := false
+	responder := responderFunc(func(*http.Response) error {
+		called = true
+		return nil
+	})
+	if err := c.DoBuild("/items", responder); !errors.Is(err, errPayment) {
+		t.Errorf("error does not match: expected %s, result: %v", errPayment, err)
+		t.FailNow()
+	}
+	if called {
+		t.Error("responder should not be called")
+		t.FailNow()
+	}
+	if !body.closed {
+		t.Error("body supposed to be closed")
+		t.FailNow()
+	}
+}
+
+func TestNewRequireHTTPS(t *testing.T) {
+	c, err := New(host, &mockWebClient{expectedUrl: "https://" + host + "/secure", expectedMethod: "GET"}, WithRequireHTTPS())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := c.DoBuild("/plain", &mockResponder{}); !errors.Is(err, request.ErrInsecureScheme) {
+		t.Errorf("error does not match: expected %s, result: %v", request.ErrInsecureScheme, err)
+		t.FailNow()
+	}
+	if err := c.DoBuild("/secure", &mockResponder{}, request.WithProtocol("https")); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
 func TestNewPath(t *testing.T) {
 	reqGet := "/get-endpoint"
 	c, err := New(host, &mockWebClient{
@@ -86,54 +528,1263 @@ func TestNewGeneralPathCustom(t *testing.T) {
 	}
 }
 
-func TestNewErr(t *testing.T) {
-	_, err := New(host, &mockWebClient{}, func(c *Connector) error {
-		return errors.New("mocked error")
-	})
-	if err == nil {
-		t.Error("expected error")
+func TestNewQueryStruct(t *testing.T) {
+	reqGet := "/get-endpoint"
+	c, err := New(host, &mockWebClient{
+		expectedUrl:    "http://" + host + reqGet + "?version=2",
+		expectedMethod: "GET",
+	},
+		WithQueryStruct(struct {
+			Version int `url:"version"`
+		}{Version: 1}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild(reqGet, &mockResponder{}, request.WithSetQuery("version", 2))
+	if err != nil {
+		t.Error(err)
 		t.FailNow()
 	}
 }
 
-func TestNewErrBuild(t *testing.T) {
+func TestNewHeaderProvider(t *testing.T) {
 	reqGet := "/get-endpoint"
-	c, err := New(host, &mockWebClient{})
+	token := 0
+	client := &mockWebClient{}
+	c, err := New(host, client,
+		WithHeaderProvider(func() http.Header {
+			token++
+			return http.Header{"Authorization": {fmt.Sprint("token-", token)}, "X-Custom": {"provided"}}
+		}))
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	err = c.DoBuild(reqGet, &mockResponder{}, func(r *request.Builder) error {
-		return errors.New("mocked error")
-	})
-	if err == nil {
-		t.Error("expected error")
-		t.FailNow()
+	for _, expected := range []string{"token-1", "token-2"} {
+		err = c.DoBuild(reqGet, &mockResponder{}, request.WithHeader("X-Custom", "custom"))
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if client.lastReq.Header.Get("Authorization") != expected {
+			t.Errorf("header does not match: expected %s, result: %s", expected, client.lastReq.Header.Get("Authorization"))
+			t.FailNow()
+		}
+		if client.lastReq.Header.Get("X-Custom") != "custom" {
+			t.Errorf("header does not match: expected %s, result: %s", "custom", client.lastReq.Header.Get("X-Custom"))
+			t.FailNow()
+		}
 	}
 }
 
-func TestNewErrDo(t *testing.T) {
+func TestNewExpectedContentType(t *testing.T) {
 	reqGet := "/get-endpoint"
-	c, err := New(host, &mockWebClient{err: errors.New("mocked error")})
+	c, err := New(host, &mockWebClient{
+		resp: &http.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"application/json; charset=utf-8"}}},
+	},
+		WithExpectedContentType("application/json"))
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
 	err = c.DoBuild(reqGet, &mockResponder{})
-	if err == nil {
-		t.Error("expected error")
+	if err != nil {
+		t.Error(err)
 		t.FailNow()
 	}
 }
 
-type mockWebClient struct {
+func TestNewExpectedContentTypeErr(t *testing.T) {
+	reqGet := "/get-endpoint"
+	body := &closeTrackingBody{Reader: strings.NewReader("<html></html>")}
+	c, err := New(host, &mockWebClient{
+		resp: &http.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/html"}}, ContentLength: -1, Body: body},
+	},
+		WithExpectedContentType("application/json"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild(reqGet, &mockResponder{})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+	if !strings.Contains(err.Error(), "text/html") {
+		t.Errorf("error does not match: result: %s", err.Error())
+		t.FailNow()
+	}
+	if !body.closed {
+		t.Error("body supposed to be closed")
+		t.FailNow()
+	}
+}
+
+func TestWith(t *testing.T) {
+	reqGet := "/get-endpoint"
+	base, err := New(host, &mockWebClient{}, WithGeneral(request.WithHeader("X-Base", "base")))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	derived, err := base.With(WithPath(reqGet), WithGeneral(request.WithHeader("X-Derived", "derived")))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if _, ok := base.pathOptions[reqGet]; ok {
+		t.Error("base connector should not have the derived path")
+		t.FailNow()
+	}
+	if len(base.generalOption) != 1 || len(derived.generalOption) != 2 {
+		t.Errorf("general options does not match: expected %d and %d, result: %d and %d", 1, 2, len(base.generalOption), len(derived.generalOption))
+		t.FailNow()
+	}
+	if _, ok := derived.pathOptions[reqGet]; !ok {
+		t.Error("derived connector should have the path")
+		t.FailNow()
+	}
+}
+
+func TestWithErr(t *testing.T) {
+	base, err := New(host, &mockWebClient{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	_, err = base.With(func(c *Connector) error {
+		return errors.New("mocked error")
+	})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestNewBodyMetrics(t *testing.T) {
+	reqGet := "/users/:id"
+	body := `{"name":"name field"}`
+	var metricPath string
+	var metricBytes int64
+	c, err := New(host, &mockWebClient{
+		resp: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body))},
+	},
+		WithBodyMetrics(func(path string, bytesRead int64) {
+			metricPath = path
+			metricBytes = bytesRead
+		}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	resp := struct {
+		Name string `json:"name"`
+	}{}
+	responder, err := response.NewResponder(response.ForJson(200, &resp))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild(reqGet, &responder, request.WithParam("id", 1))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if metricPath != reqGet {
+		t.Errorf("path does not match: expected %s, result: %s", reqGet, metricPath)
+		t.FailNow()
+	}
+	if metricBytes != int64(len(body)) {
+		t.Errorf("bytes read does not match: expected %d, result: %d", len(body), metricBytes)
+		t.FailNow()
+	}
+}
+
+func TestNewErr(t *testing.T) {
+	_, err := New(host, &mockWebClient{}, func(c *Connector) error {
+		return errors.New("mocked error")
+	})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestNewErrBuild(t *testing.T) {
+	reqGet := "/get-endpoint"
+	c, err := New(host, &mockWebClient{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild(reqGet, &mockResponder{}, func(r *request.Builder) error {
+		return errors.New("mocked error")
+	})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestNewErrDo(t *testing.T) {
+	reqGet := "/get-endpoint"
+	c, err := New(host, &mockWebClient{err: errors.New("mocked error")})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild(reqGet, &mockResponder{})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestNewPathMethod(t *testing.T) {
+	reqGet := "/get-endpoint"
+	c, err := New(host, &mockWebClient{
+		expectedUrl:    "http://" + host + reqGet,
+		expectedMethod: "GET",
+	},
+		WithPathMethod(reqGet, request.MethodGet))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild(reqGet, &mockResponder{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+func TestNewPathMethodErr(t *testing.T) {
+	reqGet := "/get-endpoint"
+	c, err := New(host, &mockWebClient{}, WithPathMethod(reqGet, request.MethodGet))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild(reqGet, &mockResponder{}, request.WithMethod(request.MethodPost))
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+	if !strings.Contains(err.Error(), "locked to method GET") {
+		t.Errorf("error does not match: result: %s", err.Error())
+		t.FailNow()
+	}
+}
+
+func TestDownload(t *testing.T) {
+	reqGet := "/file"
+	body := "file content"
+	c, err := New(host, &mockWebClient{
+		expectedUrl: "http://" + host + reqGet,
+		resp:        &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body))},
+	})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	filePath := filepath.Join(t.TempDir(), "download.txt")
+	err = c.Download(reqGet, filePath)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if string(all) != body {
+		t.Errorf("file content does not match: expected %s, result: %s", body, string(all))
+		t.FailNow()
+	}
+}
+
+func TestDownloadErr(t *testing.T) {
+	reqGet := "/file"
+	c, err := New(host, &mockWebClient{
+		resp: &http.Response{StatusCode: 404, Body: ioutil.NopCloser(bytes.NewBufferString("not found"))},
+	})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	filePath := filepath.Join(t.TempDir(), "download.txt")
+	err = c.Download(reqGet, filePath)
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Error("expected file to be removed")
+		t.FailNow()
+	}
+}
+
+func TestDoJson(t *testing.T) {
+	reqGet := "/users/1"
+	c, err := New(host, &mockWebClient{
+		resp: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"name":"name field"}`))},
+	})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	user, err := DoJson[struct {
+		Name string `json:"name"`
+	}](c, reqGet)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if user.Name != "name field" {
+		t.Errorf("body does not match: expected %s, result: %s", "name field", user.Name)
+		t.FailNow()
+	}
+}
+
+func TestDoJsonErr(t *testing.T) {
+	reqGet := "/users/1"
+	c, err := New(host, &mockWebClient{
+		resp: &http.Response{StatusCode: 404, Body: ioutil.NopCloser(bytes.NewBufferString(`{}`))},
+	})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	_, err = DoJson[map[string]interface{}](c, reqGet)
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestDoBuildDeadlineRelease(t *testing.T) {
+	reqGet := "/get-endpoint"
+	client := &mockWebClient{resp: &http.Response{StatusCode: 200}}
+	c, err := New(host, client)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild(reqGet, &mockResponder{}, request.WithDeadline(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if client.lastReq.Context().Err() != context.Canceled {
+		t.Errorf("context error does not match: expected %s, result: %v", context.Canceled, client.lastReq.Context().Err())
+		t.FailNow()
+	}
+}
+
+func TestNewExpectedContentTypeNoBody(t *testing.T) {
+	reqGet := "/get-endpoint"
+	c, err := New(host, &mockWebClient{
+		resp: &http.Response{StatusCode: 204, Header: http.Header{}},
+	},
+		WithExpectedContentType("application/json"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild(reqGet, &mockResponder{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+func TestNewExpectedContentTypeHead(t *testing.T) {
+	reqHead := "/head-endpoint"
+	c, err := New(host, &mockWebClient{
+		resp: &http.Response{StatusCode: 200, Header: http.Header{}, ContentLength: -1, Body: http.NoBody},
+	},
+		WithExpectedContentType("application/json"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoBuild(reqHead, &mockResponder{}, request.WithMethod(request.MethodHead))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+func TestSingleFlight(t *testing.T) {
+	reqGet := "/get-endpoint"
+	client := &countingWebClient{release: make(chan struct{}), body: "shared body"}
+	c, err := New(host, client, WithSingleFlight())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	callers := 10
+	bodies := make([]string, callers)
+	errs := make([]error, callers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responder, err := response.NewResponder(response.ForString(200, &bodies[i]))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = c.DoBuild(reqGet, &responder)
+		}(i)
+	}
+	waitUntil(t, func() bool { return flightDups(c) == callers-1 })
+	close(client.release)
+	wg.Wait()
+
+	for i := 0; i < callers; i++ {
+		if errs[i] != nil {
+			t.Error(errs[i])
+			t.FailNow()
+		}
+		if bodies[i] != "shared body" {
+			t.Errorf("body does not match: expected %s, result: %s", "shared body", bodies[i])
+			t.FailNow()
+		}
+	}
+	if calls := atomic.LoadInt32(&client.calls); calls != 1 {
+		t.Errorf("backend calls does not match: expected %d, result: %d", 1, calls)
+		t.FailNow()
+	}
+}
+
+func TestSingleFlightCredentials(t *testing.T) {
+	reqGet := "/get-endpoint"
+	client := &countingWebClient{release: make(chan struct{}), echoAuth: true}
+	c, err := New(host, client, WithSingleFlight())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	tokens := []string{"alice", "bob"}
+	bodies := make([]string, len(tokens))
+	errs := make([]error, len(tokens))
+	wg := sync.WaitGroup{}
+	for i, token := range tokens {
+		wg.Add(1)
+		go func(i int, token string) {
+			defer wg.Done()
+			responder, err := response.NewResponder(response.ForString(200, &bodies[i]))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = c.DoBuild(reqGet, &responder, request.WithBearerToken(token))
+		}(i, token)
+	}
+	waitUntil(t, func() bool { return atomic.LoadInt32(&client.calls) == 2 })
+	close(client.release)
+	wg.Wait()
+
+	for i, token := range tokens {
+		if errs[i] != nil {
+			t.Error(errs[i])
+			t.FailNow()
+		}
+		if bodies[i] != "Bearer "+token {
+			t.Errorf("body does not match: expected %s, result: %s", "Bearer "+token, bodies[i])
+			t.FailNow()
+		}
+	}
+}
+
+func TestSingleFlightFollowerContext(t *testing.T) {
+	reqGet := "/get-endpoint"
+	client := &countingWebClient{release: make(chan struct{}), body: "shared body"}
+	c, err := New(host, client, WithSingleFlight())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	leaderErr := make(chan error, 1)
+	go func() {
+		leaderErr <- c.DoBuild(reqGet, &mockResponder{})
+	}()
+	waitUntil(t, func() bool { return atomic.LoadInt32(&client.calls) == 1 })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	followerErr := make(chan error, 1)
+	go func() {
+		followerErr <- c.DoBuild(reqGet, &mockResponder{}, request.WithContext(ctx))
+	}()
+	waitUntil(t, func() bool { return flightDups(c) == 1 })
+	cancel()
+
+	if err := <-followerErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("error does not match: expected %s, result: %v", context.Canceled, err)
+		t.FailNow()
+	}
+	close(client.release)
+	if err := <-leaderErr; err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+func TestSingleFlightLeaderCanceled(t *testing.T) {
+	reqGet := "/get-endpoint"
+	client := &countingWebClient{release: make(chan struct{}), body: "shared body"}
+	c, err := New(host, client, WithSingleFlight())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		leaderErr <- c.DoBuild(reqGet, &mockResponder{}, request.WithContext(ctx))
+	}()
+	waitUntil(t, func() bool { return atomic.LoadInt32(&client.calls) == 1 })
+
+	var body string
+	followerErr := make(chan error, 1)
+	go func() {
+		responder, err := response.NewResponder(response.ForString(200, &body))
+		if err != nil {
+			followerErr <- err
+			return
+		}
+		followerErr <- c.DoBuild(reqGet, &responder)
+	}()
+	waitUntil(t, func() bool { return flightDups(c) == 1 })
+	cancel()
+
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("error does not match: expected %s, result: %v", context.Canceled, err)
+		t.FailNow()
+	}
+	waitUntil(t, func() bool { return atomic.LoadInt32(&client.calls) == 2 })
+	close(client.release)
+	if err := <-followerErr; err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if body != "shared body" {
+		t.Errorf("body does not match: expected %s, result: %s", "shared body", body)
+		t.FailNow()
+	}
+}
+
+// flightDups returns the number of callers waiting for the calls in flight
+func flightDups(c Connector) int {
+	c.flight.mu.Lock()
+	defer c.flight.mu.Unlock()
+	dups := 0
+	for _, call := range c.flight.calls {
+		dups += call.dups
+	}
+	return dups
+}
+
+// waitUntil waits for the condition, failing the test after a few seconds
+func waitUntil(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Error("condition not reached")
+			t.FailNow()
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDoStatus(t *testing.T) {
+	reqGet := "/get-endpoint"
+	c, err := New(host, &mockWebClient{resp: &http.Response{StatusCode: 404}})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	status, err := c.DoStatus(reqGet, &mockResponder{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if status != 404 {
+		t.Errorf("status does not match: expected %d, result: %d", 404, status)
+		t.FailNow()
+	}
+}
+
+func TestDoStatusErr(t *testing.T) {
+	reqGet := "/get-endpoint"
+	c, err := New(host, &mockWebClient{err: errors.New("mocked error")})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	status, err := c.DoStatus(reqGet, &mockResponder{})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+	if status != 0 {
+		t.Errorf("status does not match: expected %d, result: %d", 0, status)
+		t.FailNow()
+	}
+}
+
+func TestSingleFlightRedirectKey(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+host+"/old", nil)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	req = withFlightKey(req, "GET http://"+host+"/old")
+	location, _ := url.Parse("http://" + host + "/new")
+	next, err := redirectRequest(req, location, http.StatusFound)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "GET http://" + host + "/new "
+	if key := flightKey(next); !strings.HasPrefix(key, expected) {
+		t.Errorf("flight key does not match: expected %s..., result: %s", expected, key)
+		t.FailNow()
+	}
+}
+
+func TestDoFollow(t *testing.T) {
+	client := &redirectWebClient{locations: map[string]string{
+		"/start":  "/middle",
+		"/middle": "http://other.host/end",
+	}}
+	c, err := New(host, client)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	var body string
+	responder, err := response.NewResponder(response.ForString(200, &body))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoFollow("/start", &responder, 2, request.WithHeader("Authorization", "secret"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if body != "http://other.host/end" {
+		t.Errorf("body does not match: expected %s, result: %s", "http://other.host/end", body)
+		t.FailNow()
+	}
+	if client.lastReq.Header.Get("Authorization") != "" {
+		t.Error("authorization should not be sent to other host")
+		t.FailNow()
+	}
+}
+
+func TestDoFollowErr(t *testing.T) {
+	client := &redirectWebClient{locations: map[string]string{
+		"/start":  "/middle",
+		"/middle": "/end",
+	}}
+	c, err := New(host, client)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = c.DoFollow("/start", &mockResponder{}, 1)
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+// redirectWebClient redirects the mapped paths, and returns the url as body for the others
+type redirectWebClient struct {
+	locations map[string]string
+	lastReq   *http.Request
+}
+
+func (m *redirectWebClient) Do(req *http.Request) (*http.Response, error) {
+	m.lastReq = req
+	if location, ok := m.locations[req.URL.Path]; ok {
+		return &http.Response{StatusCode: 302, Header: http.Header{"Location": {location}}}, nil
+	}
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(req.URL.String()))}, nil
+}
+
+func TestStream(t *testing.T) {
+	reqGet := "/export"
+	client := &mockWebClient{
+		expectedUrl: "http://" + host + reqGet,
+		resp:        &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString("streamed"))},
+	}
+	c, err := New(host, client)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	res, err := c.Stream(reqGet)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer res.Body.Close()
+	if client.lastReq == nil {
+		t.Error("web client was not invoked")
+		t.FailNow()
+	}
+	all, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if string(all) != "streamed" {
+		t.Errorf("body does not match: expected %s, result: %s", "streamed", string(all))
+		t.FailNow()
+	}
+}
+
+func TestStreamMaxInFlight(t *testing.T) {
+	reqGet := "/export"
+	client := &mockWebClient{resp: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString("streamed"))}}
+	c, err := New(host, client, WithMaxInFlight(1))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	res, err := c.Stream(reqGet)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Stream(reqGet, request.WithContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error does not match: expected %s, result: %v", context.DeadlineExceeded, err)
+		t.FailNow()
+	}
+
+	_ = res.Body.Close()
+	res, err = c.Stream(reqGet)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	_ = res.Body.Close()
+}
+
+func TestStreamResponseHook(t *testing.T) {
+	reqGet := "/export"
+	errHook := errors.New("hook error")
+	client := &mockWebClient{resp: &http.Response{StatusCode: 500, Body: ioutil.NopCloser(bytes.NewBufferString("error"))}}
+	c, err := New(host, client, WithResponseHook(func(res *http.Response) error {
+		if res.StatusCode == 500 {
+			return errHook
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if _, err := c.Stream(reqGet); !errors.Is(err, errHook) {
+		t.Errorf("error does not match: expected %s, result: %v", errHook, err)
+		t.FailNow()
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	reqGet := "/users"
+	client := &pagesWebClient{pages: []string{"a", "b", ""}}
+	c, err := New(host, client, WithPageQuery("p"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	var result []string
+	err = c.Paginate(context.Background(), reqGet, func(page int, resp *http.Response) (bool, error) {
+		all, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return false, err
+		}
+		if len(all) == 0 {
+			return false, nil
+		}
+		result = append(result, fmt.Sprint(page, string(all)))
+		return true, nil
+	})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if strings.Join(result, ",") != "1a,2b" {
+		t.Errorf("pages does not match: expected %s, result: %s", "1a,2b", strings.Join(result, ","))
+		t.FailNow()
+	}
+	if client.calls != 3 {
+		t.Errorf("calls does not match: expected %d, result: %d", 3, client.calls)
+		t.FailNow()
+	}
+	for i, body := range client.bodies {
+		if !body.closed {
+			t.Errorf("body of page %d supposed to be closed", i+1)
+			t.FailNow()
+		}
+	}
+}
+
+func TestPaginateCanceled(t *testing.T) {
+	reqGet := "/users"
+	c, err := New(host, &pagesWebClient{pages: []string{"a", "b", ""}})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	err = c.Paginate(ctx, reqGet, func(page int, resp *http.Response) (bool, error) {
+		cancel()
+		return true, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error does not match: expected %s, result: %v", context.Canceled, err)
+		t.FailNow()
+	}
+}
+
+func TestDefaultClient(t *testing.T) {
+	client, err := DefaultClient(
+		WithTLSHandshakeTimeout(2*time.Second),
+		WithResponseHeaderTimeout(3*time.Second),
+		WithIdleConnTimeout(4*time.Second),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Errorf("transport does not match: result: %T", client.Transport)
+		t.FailNow()
+	}
+	if transport.TLSHandshakeTimeout != 2*time.Second {
+		t.Errorf("tls handshake timeout does not match: expected %s, result: %s", 2*time.Second, transport.TLSHandshakeTimeout)
+		t.FailNow()
+	}
+	if transport.ResponseHeaderTimeout != 3*time.Second {
+		t.Errorf("response header timeout does not match: expected %s, result: %s", 3*time.Second, transport.ResponseHeaderTimeout)
+		t.FailNow()
+	}
+	if transport.IdleConnTimeout != 4*time.Second {
+		t.Errorf("idle conn timeout does not match: expected %s, result: %s", 4*time.Second, transport.IdleConnTimeout)
+		t.FailNow()
+	}
+}
+
+func TestDefaultClientDialTimeout(t *testing.T) {
+	cfg, err := newClientConfig(WithDialTimeout(time.Second))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if cfg.dialer.Timeout != time.Second {
+		t.Errorf("dial timeout does not match: expected %s, result: %s", time.Second, cfg.dialer.Timeout)
+		t.FailNow()
+	}
+}
+
+func TestDefaultClientKeepAlives(t *testing.T) {
+	cfg, err := newClientConfig(WithDisableKeepAlives(true), WithMaxIdleConnsPerHost(50))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if !cfg.transport.DisableKeepAlives {
+		t.Errorf("disable keep alives does not match: expected %t, result: %t", true, cfg.transport.DisableKeepAlives)
+		t.FailNow()
+	}
+	if cfg.transport.MaxIdleConnsPerHost != 50 {
+		t.Errorf("max idle conns per host does not match: expected %d, result: %d", 50, cfg.transport.MaxIdleConnsPerHost)
+		t.FailNow()
+	}
+}
+
+func TestDefaultClientMaxIdleConnsPerHostErr(t *testing.T) {
+	_, err := DefaultClient(WithMaxIdleConnsPerHost(-1))
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestDefaultClientErr(t *testing.T) {
+	_, err := DefaultClient(func(c *clientConfig) error {
+		return errors.New("mocked error")
+	})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+// pagesWebClient returns the page of the "p" or "page" query param
+type pagesWebClient struct {
+	pages  []string
+	calls  int
+	bodies []*closeTrackingBody
+}
+
+func (m *pagesWebClient) Do(req *http.Request) (*http.Response, error) {
+	m.calls++
+	page := req.URL.Query().Get("p")
+	if page == "" {
+		page = req.URL.Query().Get("page")
+	}
+	var i int
+	if _, err := fmt.Sscan(page, &i); err != nil || i < 1 || i > len(m.pages) {
+		return nil, errors.New("invalid page")
+	}
+	body := &closeTrackingBody{Reader: bytes.NewBufferString(m.pages[i-1])}
+	m.bodies = append(m.bodies, body)
+	return &http.Response{StatusCode: 200, Body: body}, nil
+}
+
+func TestMaxInFlight(t *testing.T) {
+	reqGet := "/get-endpoint"
+	client := &concurrencyWebClient{}
+	c, err := New(host, client, WithMaxInFlight(3))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = c.DoBuild(reqGet, &mockResponder{})
+		}()
+	}
+	wg.Wait()
+	if max := atomic.LoadInt32(&client.max); max > 3 {
+		t.Errorf("max in flight does not match: expected at most %d, result: %d", 3, max)
+		t.FailNow()
+	}
+}
+
+func TestMaxInFlightCanceled(t *testing.T) {
+	reqGet := "/get-endpoint"
+	c, err := New(host, &mockWebClient{}, WithMaxInFlight(1))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	c.inFlight <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = c.DoBuild(reqGet, &mockResponder{}, request.WithContext(ctx))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error does not match: expected %s, result: %v", context.DeadlineExceeded, err)
+		t.FailNow()
+	}
+}
+
+func TestMaxInFlightErr(t *testing.T) {
+	_, err := New(host, &mockWebClient{}, WithMaxInFlight(0))
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+// concurrencyWebClient records the max number of concurrent calls
+type concurrencyWebClient struct {
+	current int32
+	max     int32
+}
+
+func (m *concurrencyWebClient) Do(req *http.Request) (*http.Response, error) {
+	current := atomic.AddInt32(&m.current, 1)
+	for {
+		max := atomic.LoadInt32(&m.max)
+		if current <= max || atomic.CompareAndSwapInt32(&m.max, max, current) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	atomic.AddInt32(&m.current, -1)
+	return &http.Response{StatusCode: 200, Request: req}, nil
+}
+
+func TestRetry(t *testing.T) {
+	reqPost := "/post-endpoint"
+	client := &failingWebClient{failures: 2}
+	c, err := New(host, client, WithRetry(3, func(res *http.Response, err error) bool {
+		return err == nil && res.StatusCode == 503
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	status, err := c.DoStatus(reqPost, &mockResponder{}, request.WithMethod(request.MethodPost), request.WithString("myBody"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if status != 200 {
+		t.Errorf("status does not match: expected %d, result: %d", 200, status)
+		t.FailNow()
+	}
+	if client.calls != 3 {
+		t.Errorf("calls does not match: expected %d, result: %d", 3, client.calls)
+		t.FailNow()
+	}
+	if strings.Join(client.bodies, ",") != "myBody,myBody,myBody" {
+		t.Errorf("bodies does not match: expected %s, result: %s", "myBody,myBody,myBody", strings.Join(client.bodies, ","))
+		t.FailNow()
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	reqGet := "/get-endpoint"
+	client := &failingWebClient{failures: 2}
+	c, err := New(host, client,
+		WithRetry(3, func(res *http.Response, err error) bool {
+			return err == nil && res.StatusCode == 503
+		}),
+		WithRetryBackoff(20*time.Millisecond, 40*time.Millisecond))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := c.DoBuild(reqGet, &mockResponder{}); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if len(client.times) != 3 {
+		t.Errorf("calls does not match: expected %d, result: %d", 3, len(client.times))
+		t.FailNow()
+	}
+	// half of each wait is random: at least 10ms before the first retry and 20ms before the second
+	for i, min := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond} {
+		if gap := client.times[i+1].Sub(client.times[i]); gap < min {
+			t.Errorf("retry wait does not match: expected at least %s, result: %s", min, gap)
+			t.FailNow()
+		}
+	}
+}
+
+func TestRetryBackoffContext(t *testing.T) {
+	reqGet := "/get-endpoint"
+	client := &failingWebClient{failures: 2}
+	c, err := New(host, client,
+		WithRetry(3, func(res *http.Response, err error) bool {
+			return err == nil && res.StatusCode == 503
+		}),
+		WithRetryBackoff(time.Hour, time.Hour))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = c.DoBuild(reqGet, &mockResponder{}, request.WithContext(ctx))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error does not match: expected %s, result: %v", context.DeadlineExceeded, err)
+		t.FailNow()
+	}
+	if client.calls != 1 {
+		t.Errorf("calls does not match: expected %d, result: %d", 1, client.calls)
+		t.FailNow()
+	}
+}
+
+func TestRetryBackoffErr(t *testing.T) {
+	_, err := New(host, &mockWebClient{}, WithRetryBackoff(time.Second, time.Millisecond))
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	reqGet := "/get-endpoint"
+	client := &failingWebClient{failures: 1000}
+	c, err := New(host, client,
+		WithRetry(5, func(res *http.Response, err error) bool {
+			return err == nil && res.StatusCode == 503
+		}),
+		WithRetryBudget(0.1, 1),
+		WithRetryBackoff(time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	for i := 0; i < 3; i++ {
+		_ = c.DoBuild(reqGet, &mockResponder{})
+	}
+	// 10 retries in the window plus 10% of the requests: 5 + 5 retries, then the budget is exhausted
+	if client.calls != 13 {
+		t.Errorf("calls does not match: expected %d, result: %d", 13, client.calls)
+		t.FailNow()
+	}
+}
+
+func TestDoBatch(t *testing.T) {
+	reqGet := "/users/:id"
+	errNotFound := errors.New("not found")
+	c, err := New(host, &concurrencyWebClient{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	responder := responderFunc(func(res *http.Response) error {
+		if strings.HasSuffix(res.Request.URL.Path, "/2") {
+			return nil
+		}
+		return errNotFound
+	})
+	err = c.DoBatch(reqGet, responder,
+		[]request.Option{request.WithParam("id", "1")},
+		[]request.Option{request.WithParam("id", "2")},
+		[]request.Option{request.WithParam("id", "3")},
+	)
+	var multi *MultiError
+	if !errors.As(err, &multi) {
+		t.Errorf("error does not match: expected %T, result: %v", multi, err)
+		t.FailNow()
+	}
+	if len(multi.Errors) != 2 || multi.Errors[0].Index != 0 || multi.Errors[1].Index != 2 {
+		t.Errorf("failed items does not match: expected %s, result: %v", "0 and 2", multi.Errors)
+		t.FailNow()
+	}
+	if !errors.Is(err, errNotFound) {
+		t.Errorf("error does not match: expected %s, result: %v", errNotFound, err)
+		t.FailNow()
+	}
+}
+
+func TestBufferResponses(t *testing.T) {
+	reqGet := "/get-endpoint"
+	client := &sequenceWebClient{bodies: []string{`{"code":"TRY_AGAIN"}`, `{"code":"DONE"}`}}
+	c, err := New(host, client,
+		WithBufferResponses(1024),
+		WithRetry(3, func(res *http.Response, err error) bool {
+			var body struct {
+				Code string `json:"code"`
+			}
+			return err == nil && json.NewDecoder(res.Body).Decode(&body) == nil && body.Code == "TRY_AGAIN"
+		}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	var body string
+	responder, _ := response.NewResponder(response.ForString(200, &body))
+	if err := c.DoBuild(reqGet, &responder); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if client.calls != 2 {
+		t.Errorf("calls does not match: expected %d, result: %d", 2, client.calls)
+		t.FailNow()
+	}
+	if body != `{"code":"DONE"}` {
+		t.Errorf("body does not match: expected %s, result: %s", `{"code":"DONE"}`, body)
+		t.FailNow()
+	}
+}
+
+func TestBufferResponsesErr(t *testing.T) {
+	_, err := New(host, &mockWebClient{}, WithBufferResponses(0))
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+// sequenceWebClient responds 200 with the bodies in sequence, repeating the last one
+type sequenceWebClient struct {
+	bodies []string
+	calls  int
+}
+
+func (m *sequenceWebClient) Do(*http.Request) (*http.Response, error) {
+	body := m.bodies[len(m.bodies)-1]
+	if m.calls < len(m.bodies) {
+		body = m.bodies[m.calls]
+	}
+	m.calls++
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body))}, nil
+}
+
+// failingWebClient returns 503 for the first failures calls, then 200
+type failingWebClient struct {
+	failures int
+	calls    int
+	bodies   []string
+	times    []time.Time
+}
+
+func (m *failingWebClient) Do(req *http.Request) (*http.Response, error) {
+	m.calls++
+	m.times = append(m.times, time.Now())
+	if req.Body != nil {
+		all, _ := ioutil.ReadAll(req.Body)
+		m.bodies = append(m.bodies, string(all))
+	}
+	if m.calls <= m.failures {
+		return &http.Response{StatusCode: 503, Body: ioutil.NopCloser(bytes.NewBufferString("unavailable"))}, nil
+	}
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString("ok"))}, nil
+}
+
+// countingWebClient counts the calls, holding them until release is closed or the request is canceled
+// With echoAuth, the body is the Authorization header of the request
+type countingWebClient struct {
+	calls    int32
+	release  chan struct{}
+	body     string
+	echoAuth bool
+}
+
+func (m *countingWebClient) Do(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&m.calls, 1)
+	if m.release != nil {
+		select {
+		case <-m.release:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	body := m.body
+	if m.echoAuth {
+		body = req.Header.Get("Authorization")
+	}
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body))}, nil
+}
+
+type mockWebClient struct {
 	expectedUrl    string
 	expectedMethod string
 	resp           *http.Response
 	err            error
+	lastReq        *http.Request
 }
 
 func (m *mockWebClient) Do(req *http.Request) (*http.Response, error) {
+	m.lastReq = req
 	if m.expectedUrl != "" && req.URL.String() != m.expectedUrl {
 		return nil, errors.New("unmatching url")
 	}
@@ -143,6 +1794,17 @@ func (m *mockWebClient) Do(req *http.Request) (*http.Response, error) {
 	return m.resp, m.err
 }
 
+// closeTrackingBody tells if the body was closed
+type closeTrackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeTrackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
 type mockResponder struct {
 	err error
 }
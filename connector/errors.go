@@ -0,0 +1,25 @@
+package connector
+
+import "fmt"
+
+// ConnectorError is returned by DoBuild, telling the endpoint of the failure
+// errors.Unwrap returns the original cause
+type ConnectorError struct {
+	// Path is the path of the endpoint, like /users/:id
+	Path string
+	// Method is the http method of the request, or the one set by the options applied before the build failed
+	Method string
+	// Err is the original cause
+	Err error
+}
+
+func (e *ConnectorError) Error() string {
+	if e.Method == "" {
+		return fmt.Sprintf("connector: %s: %s", e.Path, e.Err.Error())
+	}
+	return fmt.Sprintf("connector: %s %s: %s", e.Method, e.Path, e.Err.Error())
+}
+
+func (e *ConnectorError) Unwrap() error {
+	return e.Err
+}
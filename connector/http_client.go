@@ -0,0 +1,106 @@
+package connector
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// clientConfig holds the configs to build a http.Client
+type clientConfig struct {
+	// transport is the transport of the client
+	transport *http.Transport
+	// dialer opens the connections of the transport
+	dialer *net.Dialer
+}
+
+// ClientOption add optional values to the http.Client created by DefaultClient
+type ClientOption func(*clientConfig) error
+
+// DefaultClient creates a http.Client with a transport based on http.DefaultTransport
+// The options tune the transport, instead of only the client Timeout
+// Example:
+//		client, err := DefaultClient(
+//			WithDialTimeout(5*time.Second),
+//			WithResponseHeaderTimeout(10*time.Second),
+//		)
+//		c, err := New("my.host.com", client)
+func DefaultClient(options ...ClientOption) (*http.Client, error) {
+	cfg, err := newClientConfig(options...)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: cfg.transport}, nil
+}
+
+func newClientConfig(options ...ClientOption) (clientConfig, error) {
+	cfg := clientConfig{
+		transport: http.DefaultTransport.(*http.Transport).Clone(),
+		dialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+	}
+	cfg.transport.DialContext = cfg.dialer.DialContext
+
+	for _, o := range options {
+		if err := o(&cfg); err != nil {
+			return clientConfig{}, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// WithDialTimeout sets the maximum time to open a connection
+func WithDialTimeout(d time.Duration) ClientOption {
+	return func(c *clientConfig) error {
+		c.dialer.Timeout = d
+		return nil
+	}
+}
+
+// WithTLSHandshakeTimeout sets the maximum time to wait for the TLS handshake
+func WithTLSHandshakeTimeout(d time.Duration) ClientOption {
+	return func(c *clientConfig) error {
+		c.transport.TLSHandshakeTimeout = d
+		return nil
+	}
+}
+
+// WithResponseHeaderTimeout sets the maximum time to wait for the response headers after the request is sent
+func WithResponseHeaderTimeout(d time.Duration) ClientOption {
+	return func(c *clientConfig) error {
+		c.transport.ResponseHeaderTimeout = d
+		return nil
+	}
+}
+
+// WithIdleConnTimeout sets the maximum time an idle connection stays open
+func WithIdleConnTimeout(d time.Duration) ClientOption {
+	return func(c *clientConfig) error {
+		c.transport.IdleConnTimeout = d
+		return nil
+	}
+}
+
+// WithDisableKeepAlives disables the reuse of connections between requests
+func WithDisableKeepAlives(disable bool) ClientOption {
+	return func(c *clientConfig) error {
+		c.transport.DisableKeepAlives = disable
+		return nil
+	}
+}
+
+// WithMaxIdleConnsPerHost sets the maximum idle connections kept for each host
+// The default of 2 throttles clients making many concurrent requests to the same host
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return func(c *clientConfig) error {
+		if n < 0 {
+			return fmt.Errorf("connector: max idle conns per host must not be negative, got %d", n)
+		}
+		c.transport.MaxIdleConnsPerHost = n
+		return nil
+	}
+}
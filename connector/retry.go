@@ -0,0 +1,174 @@
+package connector
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// retryBudgetWindow is the window where the requests and retries are counted
+const retryBudgetWindow = 10 * time.Second
+
+const (
+	// defaultRetryBackoff is the wait before the first retry, doubled in each retry
+	defaultRetryBackoff = 100 * time.Millisecond
+	// defaultRetryMaxBackoff is the max wait between retries
+	defaultRetryMaxBackoff = 2 * time.Second
+)
+
+// retryPolicy tells when and how many times a request is retried
+type retryPolicy struct {
+	// maxRetries is the max number of retries of each request
+	maxRetries int
+	// retryable tells if the result of the request should be retried
+	retryable func(*http.Response, error) bool
+}
+
+// retryBudget limits the retries to a fraction of the requests
+// In each window, the allowed retries are minPerSec * window seconds + ratio * requests
+type retryBudget struct {
+	mu          sync.Mutex
+	ratio       float64
+	minPerSec   int
+	windowStart time.Time
+	requests    int
+	retries     int
+}
+
+func newRetryBudget(ratio float64, minPerSec int) *retryBudget {
+	return &retryBudget{ratio: ratio, minPerSec: minPerSec, windowStart: time.Now()}
+}
+
+// roll starts a new window when the current one expired
+func (b *retryBudget) roll() {
+	if time.Since(b.windowStart) > retryBudgetWindow {
+		b.windowStart = time.Now()
+		b.requests = 0
+		b.retries = 0
+	}
+}
+
+// request registers a new request
+func (b *retryBudget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	b.requests++
+}
+
+// allow registers a retry if the budget has room for it
+func (b *retryBudget) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	allowed := float64(b.minPerSec)*retryBudgetWindow.Seconds() + b.ratio*float64(b.requests)
+	if float64(b.retries+1) > allowed {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// doWithRetry executes the request, retrying it accordingly to the policy and the budget
+// A request with a body is only retried if the body can be replayed with GetBody
+// A response buffered by WithBufferResponses is rewound, so the responder reads it from the start
+func (c Connector) doWithRetry(req *http.Request) (res *http.Response, err error) {
+	defer func() {
+		if res != nil {
+			if body, ok := res.Body.(*replayBody); ok {
+				body.rewind()
+			}
+		}
+	}()
+	if c.retryBudget != nil {
+		c.retryBudget.request()
+	}
+	for attempt := 0; ; attempt++ {
+		res, err = c.webClient.Do(req)
+		if err == nil && c.bufferResponses > 0 && res != nil && res.Body != nil {
+			if err := bufferResponse(res, c.bufferResponses); err != nil {
+				return nil, err
+			}
+		}
+		if c.retry == nil || attempt >= c.retry.maxRetries || !c.retry.retryable(res, err) {
+			return res, err
+		}
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return res, err
+		}
+		if c.retryBudget != nil && !c.retryBudget.allow() {
+			return res, err
+		}
+		if err := req.Context().Err(); err != nil {
+			return res, err
+		}
+		if res != nil && res.Body != nil {
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+		wait := time.NewTimer(backoff(c.retryBackoff, c.retryMaxBackoff, attempt))
+		select {
+		case <-wait.C:
+		case <-req.Context().Done():
+			wait.Stop()
+			return nil, req.Context().Err()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// backoff returns the wait before the retry that follows the attempt, doubling base up to max
+// Half of the wait is random, so the retries of concurrent requests are spread
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	d := max
+	if attempt < 32 && base<<attempt > 0 && base<<attempt < max {
+		d = base << attempt
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// replayBody is a fully buffered response body, that can be read again from the start
+type replayBody struct {
+	*bytes.Reader
+	data []byte
+}
+
+func (b *replayBody) Close() error {
+	return nil
+}
+
+// rewind moves the body back to the start
+func (b *replayBody) rewind() {
+	b.Reader.Reset(b.data)
+}
+
+// bufferResponse buffers the body up to maxBytes
+// A bigger body is kept as a stream, with the bytes already read in front of it
+func bufferResponse(res *http.Response, maxBytes int64) error {
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxBytes+1))
+	if err != nil {
+		_ = res.Body.Close()
+		return err
+	}
+	if int64(len(data)) > maxBytes {
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), res.Body), res.Body}
+		return nil
+	}
+	_ = res.Body.Close()
+	res.Body = &replayBody{Reader: bytes.NewReader(data), data: data}
+	return nil
+}
@@ -0,0 +1,120 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// flightGroup coalesces concurrent identical requests into one call
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall is a call in progress or completed
+type flightCall struct {
+	done chan struct{}
+	// dups is the number of callers waiting for the call
+	dups int
+	// canceled tells the call failed because the context of its caller was done
+	canceled bool
+	res      *http.Response
+	body     []byte
+	err      error
+}
+
+// flightKeyContext is the context key of the flight key set by the build of the Connector
+type flightKeyContext struct{}
+
+// withFlightKey stores the cache key of the request builder, to be used as the base of the flight key
+func withFlightKey(req *http.Request, key string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), flightKeyContext{}, key))
+}
+
+// flightKey identifies the request for the coalescing
+// It is the cache key of the builder, or the method and url for requests not built by the Connector,
+// with a digest of the headers, so calls with different credentials never share a response
+// The trace headers are left out, since they identify the trace and not the caller
+func flightKey(req *http.Request) string {
+	key, ok := req.Context().Value(flightKeyContext{}).(string)
+	if !ok {
+		key = req.Method + " " + req.URL.String()
+	}
+
+	names := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		if k == "Traceparent" || k == "Tracestate" {
+			continue
+		}
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, k := range names {
+		for _, v := range req.Header[k] {
+			h.Write([]byte(k + ":" + v + "\n"))
+		}
+	}
+	return key + " " + hex.EncodeToString(h.Sum(nil))
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flightCall)}
+}
+
+// do executes the request once for all concurrent callers of the same key
+// The body is buffered so each caller receives its own copy of the response
+// Each caller waits at most until its own ctx is done, and if the call is given up
+// by the context of the caller that made it, the others make the call again
+func (g *flightGroup) do(ctx context.Context, key string, send func() (*http.Response, error)) (*http.Response, error) {
+	for {
+		g.mu.Lock()
+		if call, ok := g.calls[key]; ok {
+			call.dups++
+			g.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if call.canceled {
+				continue
+			}
+			return call.response()
+		}
+		call := &flightCall{done: make(chan struct{})}
+		g.calls[key] = call
+		g.mu.Unlock()
+
+		call.res, call.err = send()
+		if call.err == nil && call.res != nil && call.res.Body != nil {
+			call.body, call.err = ioutil.ReadAll(call.res.Body)
+			_ = call.res.Body.Close()
+		}
+		call.canceled = call.err != nil && ctx.Err() != nil
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+
+		return call.response()
+	}
+}
+
+// response returns a copy of the shared response with a fresh body
+func (call *flightCall) response() (*http.Response, error) {
+	if call.err != nil || call.res == nil {
+		return call.res, call.err
+	}
+	res := *call.res
+	res.Header = call.res.Header.Clone()
+	res.Body = ioutil.NopCloser(bytes.NewReader(call.body))
+	return &res, nil
+}
@@ -0,0 +1,69 @@
+package request
+
+// The options below are With-prefixed aliases, matching the naming of the other options
+// Each one delegates to its counterpart
+
+// WithScopes is an alias of Scopes
+func WithScopes(scopes ...string) Option {
+	return Scopes(scopes...)
+}
+
+// WithRequireHTTPS is an alias of RequireHTTPS
+func WithRequireHTTPS() Option {
+	return RequireHTTPS()
+}
+
+// WithNormalizeSlashes is an alias of NormalizeSlashes
+func WithNormalizeSlashes() Option {
+	return NormalizeSlashes()
+}
+
+// WithRequireHeader is an alias of RequireHeader
+func WithRequireHeader(key string) Option {
+	return RequireHeader(key)
+}
+
+// WithMethodOverride is an alias of MethodOverride
+func WithMethodOverride(actual HttpMethod) Option {
+	return MethodOverride(actual)
+}
+
+// WithExpect100Continue is an alias of Expect100Continue
+func WithExpect100Continue() Option {
+	return Expect100Continue()
+}
+
+// WithCacheBust is an alias of CacheBust
+func WithCacheBust() Option {
+	return CacheBust()
+}
+
+// WithCacheBustParam is an alias of CacheBustParam
+func WithCacheBustParam(name string) Option {
+	return CacheBustParam(name)
+}
+
+// WithQueryBool is an alias of QueryBool
+func WithQueryBool(key string, v bool, mode BoolMode) Option {
+	return QueryBool(key, v, mode)
+}
+
+// WithQueryJSON is an alias of QueryJSON
+func WithQueryJSON(v interface{}) Option {
+	return QueryJSON(v)
+}
+
+// WithBodyFunc is an alias of BodyFunc
+func WithBodyFunc(f func() (interface{}, error)) Option {
+	return BodyFunc(f)
+}
+
+// WithTraceParent is an alias of TraceParent
+func WithTraceParent(traceID, spanID string, sampled bool) Option {
+	return TraceParent(traceID, spanID, sampled)
+}
+
+// WithAutoTraceParent is an alias of AutoTraceParent
+func WithAutoTraceParent() Option {
+	return AutoTraceParent()
+}
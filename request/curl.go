@@ -0,0 +1,78 @@
+package request
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const headerAuthorization = "Authorization"
+
+// Curl renders the request as an equivalent curl command, to reproduce it in the command line
+// The body is read without consuming it, so the request can still be sent
+// If redactAuth is true the Authorization header value is masked
+// Example:
+//		req, _ := New("my.host.com", WithMethod(MethodPost), WithJson(body))
+//		cmd, _ := Curl(req, true)
+//		// curl -X POST 'http://my.host.com' -H 'Content-Type: application/json' --data-raw '{"name":"value"}'
+func Curl(req *http.Request, redactAuth bool) (string, error) {
+	cmd := []string{"curl", "-X", req.Method, quote(req.URL.String())}
+
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			if redactAuth && k == headerAuthorization {
+				v = "***"
+			}
+			cmd = append(cmd, "-H", quote(k+": "+v))
+		}
+	}
+
+	body, err := DumpBody(req)
+	if err != nil {
+		return "", err
+	}
+	if len(body) > 0 {
+		cmd = append(cmd, "--data-raw", quote(string(body)))
+	}
+
+	return strings.Join(cmd, " "), nil
+}
+
+// DumpBody reads the body of the request without consuming it, so the request can still be sent
+// It uses req.GetBody when available, otherwise the body is buffered and req.GetBody is set
+// Useful to log the outgoing body in a WebClient wrapper
+func DumpBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return ioutil.ReadAll(body)
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	return data, nil
+}
+
+// quote quotes the value for a posix shell
+func quote(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
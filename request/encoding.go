@@ -0,0 +1,131 @@
+package request
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// jsonMarshalerType is the type of the values with their own json encoding
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// JSONEmptyAsArray returns a json encoder that encodes nil slices as [] and nil maps as {}, instead of null
+// Useful for strict servers that reject null lists
+// The value is copied before the change, the original is not modified
+// A value that refers to itself returns an error, like json.Marshal
+// Example:
+// 			WithEncoder(body, JSONEmptyAsArray(), "application/json")
+func JSONEmptyAsArray() EncoderFunc {
+	return func(v interface{}) ([]byte, error) {
+		if v == nil {
+			return json.Marshal(v)
+		}
+		out, err := emptyCollections(reflect.ValueOf(v), make(map[visit]bool))
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(out.Interface())
+	}
+}
+
+// visit identifies a pointer, map or slice being copied, to find the values that refer to themselves
+type visit struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+// emptyCollections returns a copy of v with the nil slices and maps replaced by empty ones
+// Values with their own json encoding are kept as they are
+// The seen has the pointers, maps and slices being copied, so a cycle returns an error instead of recursing forever
+func emptyCollections(v reflect.Value, seen map[visit]bool) (reflect.Value, error) {
+	if v.Type().Implements(jsonMarshalerType) || reflect.PtrTo(v.Type()).Implements(jsonMarshalerType) {
+		return v, nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if !v.IsNil() {
+			key := visit{ptr: v.Pointer(), typ: v.Type()}
+			if v.Kind() == reflect.Slice {
+				key.len = v.Len()
+			}
+			if seen[key] {
+				return v, fmt.Errorf("request: encountered a cycle via %s", v.Type())
+			}
+			seen[key] = true
+			defer delete(seen, key)
+		}
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, nil
+		}
+		elem, err := emptyCollections(v.Elem(), seen)
+		if err != nil {
+			return v, err
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(elem)
+		return out, nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v, nil
+		}
+		elem, err := emptyCollections(v.Elem(), seen)
+		if err != nil {
+			return v, err
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(elem)
+		return out, nil
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < out.NumField(); i++ {
+			if f := out.Field(i); f.CanSet() {
+				field, err := emptyCollections(f, seen)
+				if err != nil {
+					return v, err
+				}
+				f.Set(field)
+			}
+		}
+		return out, nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.MakeSlice(v.Type(), 0, 0), nil
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem, err := emptyCollections(v.Index(i), seen)
+			if err != nil {
+				return v, err
+			}
+			out.Index(i).Set(elem)
+		}
+		return out, nil
+	case reflect.Array:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			elem, err := emptyCollections(v.Index(i), seen)
+			if err != nil {
+				return v, err
+			}
+			out.Index(i).Set(elem)
+		}
+		return out, nil
+	case reflect.Map:
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, err := emptyCollections(iter.Value(), seen)
+			if err != nil {
+				return v, err
+			}
+			out.SetMapIndex(iter.Key(), elem)
+		}
+		return out, nil
+	}
+	return v, nil
+}
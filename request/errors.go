@@ -0,0 +1,41 @@
+package request
+
+import "errors"
+
+var (
+	// ErrInvalidHost is returned when the url of the request can not be built from the host and protocol
+	ErrInvalidHost = errors.New("request: invalid host")
+	// ErrEncode is returned when the body can not be encoded
+	ErrEncode = errors.New("request: encode failed")
+	// ErrUnresolvedParam is returned when the path still has a param without value
+	ErrUnresolvedParam = errors.New("request: unresolved path param")
+	// ErrInvalidMethod is returned when the method is not a known one, and custom methods are not allowed
+	ErrInvalidMethod = errors.New("request: invalid method")
+	// ErrInsecureScheme is returned when https is required, but the url has another scheme
+	ErrInsecureScheme = errors.New("request: insecure scheme")
+	// ErrMissingHeader is returned when a required header is not set
+	ErrMissingHeader = errors.New("request: missing required header")
+)
+
+// buildError wraps the cause of a failure with one of the sentinel errors
+// errors.Is matches the sentinel, while errors.Unwrap returns the cause
+type buildError struct {
+	kind  error
+	cause error
+}
+
+func wrapErr(kind, cause error) error {
+	return &buildError{kind: kind, cause: cause}
+}
+
+func (e *buildError) Error() string {
+	return e.kind.Error() + ": " + e.cause.Error()
+}
+
+func (e *buildError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *buildError) Unwrap() error {
+	return e.cause
+}
@@ -0,0 +1,52 @@
+package request
+
+import (
+	"net/url"
+	"strings"
+)
+
+// headerFormUrlEncoded is the Content-Type of the form bodies
+const headerFormUrlEncoded = "application/x-www-form-urlencoded"
+
+// KV is a key and value pair of an ordered form
+type KV struct {
+	Key   string
+	Value string
+}
+
+// WithForm sets the body as a form-urlencoded, with the keys sorted
+// This method already sets the Content-Type header as application/x-www-form-urlencoded
+func WithForm(values url.Values) Option {
+	return func(r *Builder) error {
+		r.setContentType(headerFormUrlEncoded)
+		r.setPayload([]byte(values.Encode()))
+		return nil
+	}
+}
+
+// Form is an alias of WithForm
+// The repeated keys of values are all sent
+func Form(values url.Values) Option {
+	return WithForm(values)
+}
+
+// WithFormOrdered sets the body as a form-urlencoded, keeping the order of the pairs
+// Useful for signed forms, where the fields must be sent in a specific order
+// This method already sets the Content-Type header as application/x-www-form-urlencoded
+// Example:
+// 			WithFormOrdered([]KV{
+// 				{Key: "merchant", Value: "123"},
+// 				{Key: "amount", Value: "10.00"},
+// 				{Key: "signature", Value: sign(...)},
+// 			})
+func WithFormOrdered(pairs []KV) Option {
+	return func(r *Builder) error {
+		encoded := make([]string, 0, len(pairs))
+		for _, p := range pairs {
+			encoded = append(encoded, url.QueryEscape(p.Key)+"="+url.QueryEscape(p.Value))
+		}
+		r.setContentType(headerFormUrlEncoded)
+		r.setPayload([]byte(strings.Join(encoded, "&")))
+		return nil
+	}
+}
@@ -4,6 +4,11 @@ import "net/http"
 
 type httpMethod string
 
+// HttpMethod exposes the http method type to other packages
+// Example:
+//		HttpMethod("PROPFIND")
+type HttpMethod = httpMethod
+
 const (
 	MethodPost    = httpMethod(http.MethodPost)
 	MethodGet     = httpMethod(http.MethodGet)
@@ -15,3 +20,16 @@ const (
 	MethodOptions = httpMethod(http.MethodOptions)
 	MethodTrace   = httpMethod(http.MethodTrace)
 )
+
+// knownMethods has the methods accepted without WithAllowCustomMethod
+var knownMethods = map[httpMethod]bool{
+	MethodPost:    true,
+	MethodGet:     true,
+	MethodPatch:   true,
+	MethodPut:     true,
+	MethodDelete:  true,
+	MethodHead:    true,
+	MethodConnect: true,
+	MethodOptions: true,
+	MethodTrace:   true,
+}
@@ -0,0 +1,113 @@
+package request
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+)
+
+// headerContentEncoding is the header of the encoding of a part
+const headerContentEncoding = "Content-Encoding"
+
+// Part is a part of a multipart body
+type Part struct {
+	// ContentType is the Content-Type of the part
+	ContentType string
+	// Body has the content of the part
+	Body io.Reader
+	// Gzip compresses the body of the part, setting its Content-Encoding header as gzip
+	Gzip bool
+}
+
+// WithMultipartRelated sets the body as a multipart/related with the parts in the given order
+// The type param of the Content-Type header is the content type of the first part
+// A part with Gzip is compressed, while the request remains a multipart
+// Example:
+// 			WithMultipartRelated(
+// 				Part{ContentType: "application/json", Body: strings.NewReader(`{"name":"file.bin"}`)},
+// 				Part{ContentType: "application/octet-stream", Body: file, Gzip: true},
+// 			)
+func WithMultipartRelated(parts ...Part) Option {
+	return func(r *Builder) error {
+		if len(parts) == 0 {
+			return wrapErr(ErrEncode, errors.New("multipart related without parts"))
+		}
+		b := new(bytes.Buffer)
+		w := multipart.NewWriter(b)
+		for _, p := range parts {
+			header := textproto.MIMEHeader{headerContentType: {p.ContentType}}
+			if p.Gzip {
+				header.Set(headerContentEncoding, "gzip")
+			}
+			pw, err := w.CreatePart(header)
+			if err != nil {
+				return wrapErr(ErrEncode, err)
+			}
+			if err := writePart(pw, p); err != nil {
+				return wrapErr(ErrEncode, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			return wrapErr(ErrEncode, err)
+		}
+		r.setContentType(mime.FormatMediaType("multipart/related", map[string]string{
+			"boundary": w.Boundary(),
+			"type":     parts[0].ContentType,
+		}))
+		r.setPayload(b.Bytes())
+		return nil
+	}
+}
+
+// WithMultipart sets the body as a multipart/form-data written by write
+// The Content-Type header is set with the boundary of the writer
+// write must not close the writer, it is closed after write returns
+// Example:
+// 			WithMultipart(func(w *multipart.Writer) error {
+// 				if err := w.WriteField("name", "report.csv"); err != nil {
+// 					return err
+// 				}
+// 				fw, err := w.CreateFormFile("file", "report.csv")
+// 				if err != nil {
+// 					return err
+// 				}
+// 				_, err = io.Copy(fw, file)
+// 				return err
+// 			})
+func WithMultipart(write func(*multipart.Writer) error) Option {
+	return func(r *Builder) error {
+		b := new(bytes.Buffer)
+		w := multipart.NewWriter(b)
+		if err := write(w); err != nil {
+			return wrapErr(ErrEncode, err)
+		}
+		if err := w.Close(); err != nil {
+			return wrapErr(ErrEncode, err)
+		}
+		r.setContentType(w.FormDataContentType())
+		r.setPayload(b.Bytes())
+		return nil
+	}
+}
+
+// Multipart is an alias of WithMultipart
+func Multipart(write func(*multipart.Writer) error) Option {
+	return WithMultipart(write)
+}
+
+// writePart writes the body of the part, compressing it when the part is gzip
+func writePart(w io.Writer, p Part) error {
+	if !p.Gzip {
+		_, err := io.Copy(w, p.Body)
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	if _, err := io.Copy(zw, p.Body); err != nil {
+		return err
+	}
+	return zw.Close()
+}
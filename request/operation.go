@@ -0,0 +1,42 @@
+package request
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Operation describes an endpoint declaratively, like an operation of an OpenAPI spec
+type Operation struct {
+	// Method is the http method, GET when empty
+	Method string
+	// PathTemplate is the path with the params to bind
+	// Example:
+	//		/users/:id
+	PathTemplate string
+	// DefaultHeaders has the headers added to each request of the operation
+	DefaultHeaders http.Header
+}
+
+// FromOperation creates an Option that applies the Operation and then the given options
+// Example:
+//		getUser := Operation{Method: http.MethodGet, PathTemplate: "/users/:id"}
+//		req, err := New("my.host.com", FromOperation(getUser, WithParam("id", 123)))
+func FromOperation(op Operation, options ...Option) Option {
+	return func(r *Builder) error {
+		opOptions := []Option{WithPath(op.PathTemplate)}
+		if op.Method != "" {
+			opOptions = append(opOptions, WithMethod(httpMethod(strings.ToUpper(op.Method))))
+		}
+		for k, v := range op.DefaultHeaders {
+			for _, hv := range v {
+				opOptions = append(opOptions, WithHeader(k, hv))
+			}
+		}
+		for _, o := range append(opOptions, options...) {
+			if err := o(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -6,24 +6,45 @@ package request
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
 )
 
 const (
-	headerContentType = "Content-Type"
+	headerContentType    = "Content-Type"
+	headerReferer        = "Referer"
+	headerOrigin         = "Origin"
+	headerIfMatch        = "If-Match"
+	headerMethodOverride = "X-Http-Method-Override"
+	headerExpect         = "Expect"
 )
 
 // Builder carries all the data necessary to execute a http request
 type Builder struct {
 	// ctx context for the Builder
 	ctx context.Context
+	// values has the values to store in the request context
+	values []contextValue
+	// deadline is the absolute time limit of the request context
+	deadline time.Time
 	// method is the http GET, POST...
 	method httpMethod
+	// allowCustomMethod tells if methods other than the known ones are accepted
+	allowCustomMethod bool
 	// protocol is the protocol for the Builder
 	// Example:
 	// 		http
@@ -38,14 +59,46 @@ type Builder struct {
 	//		/my/path
 	//		/:myParam
 	path string
+	// rawPath tells if the path is already percent-encoded
+	rawPath bool
 	// params has the params to bind in the path
 	params map[string]string
+	// rawParams has the params bound without percent-encoding
+	rawParams map[string]bool
 	// headers has the headers of the Builder
 	headers map[string][]string
 	// queries has the queries of the Builder
 	queries map[string][]string
+	// queryKeys has the query keys in insertion order
+	queryKeys []string
+	// queryFlags has the query keys sent without value
+	queryFlags map[string]bool
+	// preserveQueryOrder tells if the query keys keep the insertion order instead of sorted
+	preserveQueryOrder bool
+	// rawQuery is an encoded query appended as it is
+	rawQuery string
 	// body has the body for the Builder
 	body io.Reader
+	// payload has the bytes of an in-memory body, read from the start in each build
+	payload []byte
+	// chunked forces the body to be sent with chunked transfer encoding
+	chunked bool
+	// charset is the charset param added to the Content-Type header
+	charset string
+	// defaultContentType is the Content-Type of a body without one
+	defaultContentType string
+	// requireHTTPS rejects a request whose url scheme is not https
+	requireHTTPS bool
+	// bodyFunc produces the body when the request is built
+	bodyFunc func() (interface{}, error)
+	// cacheBust is the query param set with a unique value in each build
+	cacheBust string
+	// normalizeSlashes collapses the duplicated slashes of the host and path
+	normalizeSlashes bool
+	// requiredHeaders are the headers the request must have after all options
+	requiredHeaders []string
+	// autoTraceParent generates a traceparent header when the request has none
+	autoTraceParent bool
 }
 
 // New creates a new Builder
@@ -65,58 +118,296 @@ type Builder struct {
 //			)
 //		}
 func New(host string, options ...Option) (*http.Request, error) {
-	r := Builder{
-		method:   MethodGet,
-		host:     host,
-		protocol: "http",
-		params:   make(map[string]string),
-		headers:  make(map[string][]string),
-		queries:  make(map[string][]string),
+	r, err := NewBuilder(host, options...)
+	if err != nil {
+		return nil, err
 	}
+
+	return r.Build()
+}
+
+// NewBuilder creates a new Builder with the options applied, without building the request
+// It has the same defaults of New
+// Example:
+//		b, err := NewBuilder("my.host.com", WithPath("/users"), WithQuery("page", 1))
+//		...
+//		key, err := b.CacheKey()
+//		req, err := b.Build()
+func NewBuilder(host string, options ...Option) (*Builder, error) {
+	r := &Builder{
+		method:     MethodGet,
+		host:       host,
+		protocol:   "http",
+		params:     make(map[string]string),
+		headers:    make(map[string][]string),
+		queries:    make(map[string][]string),
+		queryFlags: make(map[string]bool),
+	}
+	if err := r.Apply(options...); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Apply applies the options to the Builder
+func (r *Builder) Apply(options ...Option) error {
 	for _, o := range options {
-		if err := o(&r); err != nil {
-			return nil, err
+		if err := o(r); err != nil {
+			return err
 		}
 	}
-
-	return build(r)
+	return nil
 }
 
-func build(r Builder) (*http.Request, error) {
-	q := ""
+// Snapshot captures the current state of the Builder, and returns a function that restores it
+// Useful to try variations of a request from the same base
+// Example:
+//		restore := b.Snapshot()
+//		_ = b.Apply(WithHeader("X-Experiment", "on"))
+//		withHeader, _ := b.Build()
+//		restore()
+//		withoutHeader, _ := b.Build()
+func (r *Builder) Snapshot() func() {
+	saved := r.clone()
+	return func() {
+		*r = saved.clone()
+	}
+}
 
+// clone copies the Builder, without sharing its slices and maps
+func (r *Builder) clone() Builder {
+	c := *r
+	c.values = append([]contextValue{}, r.values...)
+	c.params = make(map[string]string, len(r.params))
+	for k, v := range r.params {
+		c.params[k] = v
+	}
+	c.rawParams = make(map[string]bool, len(r.rawParams))
+	for k, v := range r.rawParams {
+		c.rawParams[k] = v
+	}
+	c.headers = make(map[string][]string, len(r.headers))
+	for k, v := range r.headers {
+		c.headers[k] = append([]string{}, v...)
+	}
+	c.queries = make(map[string][]string, len(r.queries))
 	for k, v := range r.queries {
+		c.queries[k] = append([]string{}, v...)
+	}
+	c.queryKeys = append([]string{}, r.queryKeys...)
+	c.queryFlags = make(map[string]bool, len(r.queryFlags))
+	for k, v := range r.queryFlags {
+		c.queryFlags[k] = v
+	}
+	c.requiredHeaders = append([]string{}, r.requiredHeaders...)
+	return c
+}
 
-		for _, qv := range v {
-			if len(q) == 0 {
-				q = "?"
-			} else {
-				q = q + "&"
+// Build creates the http.Request from the Builder
+// The Builder is not changed, and can be built again
+// The in-memory bodies, like the ones of WithString and WithJson, are read from the start in each build,
+// but a reader set with WithBody is shared by the builds and can only be read once
+func (r *Builder) Build() (*http.Request, error) {
+	return build(r.clone())
+}
+
+// Method returns the http method the Builder builds the request with
+func (r *Builder) Method() HttpMethod {
+	return r.method
+}
+
+// cancelKey is the context key of the cancel func of the WithDeadline context
+type cancelKey struct{}
+
+// Release releases the resources of the context created by WithDeadline, canceling it
+// It must be called when the request is done and its response body is closed,
+// otherwise the resources are only released at the deadline
+// It does nothing for a request without deadline
+func Release(req *http.Request) {
+	if cancel, ok := req.Context().Value(cancelKey{}).(context.CancelFunc); ok {
+		cancel()
+	}
+}
+
+// releaseBody calls Release when the response body is closed
+type releaseBody struct {
+	io.ReadCloser
+	req *http.Request
+}
+
+func (b releaseBody) Close() error {
+	defer Release(b.req)
+	return b.ReadCloser.Close()
+}
+
+// WebClient is an interface that is able to performs http requests
+// the http.Client can be used there
+type WebClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Do builds the request and performs it with the client
+// The build and client errors are returned as they are
+// The context of WithDeadline is released when the response body is closed
+// Example:
+//		res, err := b.Do(http.DefaultClient)
+func (r *Builder) Do(client WebClient) (*http.Response, error) {
+	req, err := r.Build()
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil || res == nil || res.Body == nil {
+		Release(req)
+		return res, err
+	}
+	res.Body = releaseBody{ReadCloser: res.Body, req: req}
+	return res, nil
+}
+
+// CacheKey returns the method and the canonical url of the Builder, to be used as a cache key
+// The query keys and values are sorted, and the duplicated slashes of the path are collapsed
+// The cache bust param is not part of the key
+func (r *Builder) CacheKey() (string, error) {
+	_, p, err := resolvePath(*r)
+	if err != nil {
+		return "", err
+	}
+
+	pairs := make([]string, 0, len(r.queries))
+	for k, values := range r.queries {
+		if k == r.cacheBust {
+			continue
+		}
+		for _, v := range values {
+			pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	for k, flag := range r.queryFlags {
+		if flag {
+			pairs = append(pairs, url.QueryEscape(k))
+		}
+	}
+	_, pathQuery := splitPath(*r)
+	for _, rawQuery := range []string{pathQuery, r.rawQuery} {
+		if rawQuery == "" {
+			continue
+		}
+		raw, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return "", err
+		}
+		for k, values := range raw {
+			for _, v := range values {
+				pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
 			}
+		}
+	}
+	sort.Strings(pairs)
+
+	scheme, host := schemeHost(*r)
+	key := fmt.Sprintf("%s %s://%s", r.method, strings.ToLower(scheme), collapseSlashes(strings.ToLower(host)+p))
+	if len(pairs) > 0 {
+		key = key + "?" + strings.Join(pairs, "&")
+	}
+	return key, nil
+}
+
+func build(r Builder) (*http.Request, error) {
+	if r.host == "" {
+		return nil, wrapErr(ErrInvalidHost, errors.New("empty host"))
+	}
+
+	if !r.allowCustomMethod && !knownMethods[r.method] {
+		return nil, wrapErr(ErrInvalidMethod, fmt.Errorf("unknown method %q", r.method))
+	}
 
-			q = q + k + "=" + qv
+	if r.bodyFunc != nil {
+		body, err := r.bodyFunc()
+		if err != nil {
+			return nil, err
+		}
+		if err := WithJson(body)(&r); err != nil {
+			return nil, err
 		}
 	}
 
-	p := r.path
-	for k, v := range r.params {
-		p = strings.ReplaceAll(p, ":"+k, v)
+	if r.payload != nil {
+		r.body = bytes.NewReader(r.payload)
+	}
+
+	if r.cacheBust != "" {
+		r.setQuery(r.cacheBust, cacheBustValue())
+	}
+
+	// the query of the path comes first, like when it was part of the url
+	_, q := splitPath(r)
+	for _, part := range []string{encodeQuery(r), r.rawQuery} {
+		if part == "" {
+			continue
+		}
+		if q != "" {
+			q = q + "&"
+		}
+		q = q + part
 	}
 
-	url := fmt.Sprintf("%s://%s%s%s", r.protocol, r.host, p, q)
+	path, rawPath, err := resolvePath(r)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme, host := schemeHost(r)
+	u, err := url.Parse(scheme + "://" + host)
+	if err != nil {
+		return nil, wrapErr(ErrInvalidHost, err)
+	}
+	// the url is built from its parts, since parsing the whole url again
+	// drops the encoded path when a part of it is not encoded, decoding the values
+	path, rawPath = u.Path+path, u.EscapedPath()+rawPath
+	if r.normalizeSlashes {
+		path, rawPath = collapseSlashes(path), collapseSlashes(rawPath)
+	}
+	u.Path, u.RawPath = path, ""
+	if rawPath != u.EscapedPath() {
+		u.RawPath = rawPath
+	}
+	u.RawQuery = q
+
+	for _, v := range r.values {
+		if r.ctx == nil {
+			r.ctx = context.Background()
+		}
+		r.ctx = context.WithValue(r.ctx, v.key, v.value)
+	}
+
+	if !r.deadline.IsZero() {
+		if r.ctx == nil {
+			r.ctx = context.Background()
+		}
+		ctx, cancel := context.WithDeadline(r.ctx, r.deadline)
+		// the cancel is kept in the context, to be called by Release when the request is done
+		r.ctx = context.WithValue(ctx, cancelKey{}, cancel)
+	}
 
 	req := new(http.Request)
 	if r.ctx != nil {
 		var err error
-		if req, err = http.NewRequestWithContext(r.ctx, string(r.method), url, r.body); err != nil {
-			return nil, err
+		if req, err = http.NewRequestWithContext(r.ctx, string(r.method), u.String(), r.body); err != nil {
+			return nil, wrapErr(ErrInvalidHost, err)
 		}
 	} else {
 		var err error
-		if req, err = http.NewRequest(string(r.method), url, r.body); err != nil {
-			return nil, err
+		if req, err = http.NewRequest(string(r.method), u.String(), r.body); err != nil {
+			return nil, wrapErr(ErrInvalidHost, err)
 		}
 	}
+	req.URL = u
+
+	if r.requireHTTPS && req.URL.Scheme != "https" {
+		return nil, wrapErr(ErrInsecureScheme, fmt.Errorf("scheme %s in %s", req.URL.Scheme, u.String()))
+	}
 
 	for k, v := range r.headers {
 		for _, hv := range v {
@@ -124,9 +415,265 @@ func build(r Builder) (*http.Request, error) {
 		}
 	}
 
+	// a request has a single content type, so only the last one set is kept
+	// the header keys are canonical, so the values of any spelling are in the set order
+	if ct := req.Header.Values(headerContentType); len(ct) > 1 {
+		req.Header.Set(headerContentType, ct[len(ct)-1])
+	}
+
+	if r.body != nil && r.defaultContentType != "" && req.Header.Get(headerContentType) == "" {
+		req.Header.Set(headerContentType, r.defaultContentType)
+	}
+
+	if ct := req.Header.Get(headerContentType); r.charset != "" && ct != "" {
+		if mediaType, params, err := mime.ParseMediaType(ct); err == nil {
+			params["charset"] = r.charset
+			req.Header.Set(headerContentType, mime.FormatMediaType(mediaType, params))
+		}
+	}
+
+	if r.autoTraceParent && req.Header.Get(headerTraceParent) == "" {
+		traceParent, err := newTraceParent()
+		if err != nil {
+			return nil, fmt.Errorf("request: trace parent: %w", err)
+		}
+		req.Header.Set(headerTraceParent, traceParent)
+	}
+
+	for _, key := range r.requiredHeaders {
+		if req.Header.Get(key) == "" {
+			return nil, wrapErr(ErrMissingHeader, errors.New(key))
+		}
+	}
+
+	if r.chunked {
+		req.ContentLength = -1
+		req.GetBody = nil
+		req.TransferEncoding = []string{"chunked"}
+	} else if r.body != nil && req.ContentLength == 0 && req.GetBody == nil {
+		// the body length is unknown, so net/http sends it chunked
+		req.ContentLength = -1
+	}
+
 	return req, nil
 }
 
+// schemeHost returns the scheme and the host of the url
+// A scheme in the host, like http://my.host.com, takes precedence over the protocol
+// An empty protocol falls back to http
+func schemeHost(r Builder) (string, string) {
+	if i := strings.Index(r.host, "://"); i >= 0 {
+		return r.host[:i], r.host[i+3:]
+	}
+	if r.protocol == "" {
+		return "http", r.host
+	}
+	return r.protocol, r.host
+}
+
+// resolvePath binds the :param and {param} in the path, failing if a :param starting a segment or a {param} is not bound
+// A brace that does not enclose a param name, like in {} or a{b/c}, is kept as it is
+// It returns the decoded path and the percent-encoded path, where the values are encoded,
+// except the ones set by WithRawParam
+// Only the path template is scanned for params, so a value is never taken for a param
+func resolvePath(r Builder) (string, string, error) {
+	keys := make([]string, 0, len(r.params))
+	for k := range r.params {
+		keys = append(keys, k)
+	}
+	// the longest keys first, so :id does not bind the prefix of :idx
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+
+	var path, rawPath strings.Builder
+	// encoded writes a part of the path that may already have escapes
+	encoded := func(s string) error {
+		decoded, err := url.PathUnescape(s)
+		if err != nil {
+			return wrapErr(ErrInvalidHost, err)
+		}
+		path.WriteString(decoded)
+		rawPath.WriteString(escapePath(s, true))
+		return nil
+	}
+	// static writes a part of the template
+	// The path of WithPath keeps its valid escapes, and a % not starting one is encoded as %25
+	static := func(s string) error {
+		if r.rawPath {
+			return encoded(s)
+		}
+		return encoded(escapePath(s, false))
+	}
+	value := func(k string) error {
+		if r.rawParams[k] {
+			return encoded(r.params[k])
+		}
+		path.WriteString(r.params[k])
+		rawPath.WriteString(url.PathEscape(r.params[k]))
+		return nil
+	}
+
+	tmpl, _ := splitPath(r)
+	from := 0
+	for i := 0; i < len(tmpl); {
+		k, n := "", 0
+		switch tmpl[i] {
+		case ':':
+			if key, ok := paramPrefix(tmpl[i+1:], keys); ok {
+				k, n = key, 1+len(key)
+			} else if (i == 0 || tmpl[i-1] == '/') && i+1 < len(tmpl) && tmpl[i+1] != '/' {
+				param := tmpl[i:]
+				if end := strings.IndexByte(param, '/'); end >= 0 {
+					param = param[:end]
+				}
+				return "", "", wrapErr(ErrUnresolvedParam, fmt.Errorf("%s in %s", param, tmpl))
+			}
+		case '{':
+			if end := strings.IndexAny(tmpl[i+1:], "/{}"); end > 0 && tmpl[i+1+end] == '}' {
+				k, n = tmpl[i+1:i+1+end], end+2
+				if _, ok := r.params[k]; !ok {
+					return "", "", wrapErr(ErrUnresolvedParam, fmt.Errorf("{%s} in %s", k, tmpl))
+				}
+			}
+		}
+		if n == 0 {
+			i++
+			continue
+		}
+		if err := static(tmpl[from:i]); err != nil {
+			return "", "", err
+		}
+		if err := value(k); err != nil {
+			return "", "", err
+		}
+		i += n
+		from = i
+	}
+	if err := static(tmpl[from:]); err != nil {
+		return "", "", err
+	}
+	return path.String(), rawPath.String(), nil
+}
+
+// splitPath returns the path template and the query of the path set by WithPath, like in /users?active=true
+// The fragment is dropped, since it is not sent
+// The path set by WithRawPath is not split, so a ? in it is encoded
+func splitPath(r Builder) (string, string) {
+	if r.rawPath {
+		return r.path, ""
+	}
+	p := r.path
+	if i := strings.IndexByte(p, '#'); i >= 0 {
+		p = p[:i]
+	}
+	if i := strings.IndexByte(p, '?'); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
+
+// escapePath escapes the chars not allowed in a percent-encoded path
+// The escapes already in s are kept, and with strict, s must only have valid escapes
+// Without strict, a % that does not start a valid escape is encoded as %25
+func escapePath(s string, strict bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '%' && (strict || validEscape(s[i:])) || c == '/' || strings.IndexByte("-._~!$&'()*+,;=:@", c) >= 0 ||
+			'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// validEscape tells if s starts with a percent escape, like %2F
+func validEscape(s string) bool {
+	return len(s) >= 3 && s[0] == '%' && isHex(s[1]) && isHex(s[2])
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// paramPrefix returns the longest key that prefixes s, the keys must be sorted by length
+func paramPrefix(s string, keys []string) (string, bool) {
+	for _, k := range keys {
+		if k != "" && strings.HasPrefix(s, k) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// collapseSlashes replaces the duplicated slashes by a single one
+func collapseSlashes(s string) string {
+	for strings.Contains(s, "//") {
+		s = strings.ReplaceAll(s, "//", "/")
+	}
+	return s
+}
+
+// encodeQuery encodes the queries of the Builder
+// The keys are sorted, unless preserveQueryOrder is set
+// The values of the same key always keep the insertion order
+func encodeQuery(r Builder) string {
+	keys := r.queryKeys
+	if !r.preserveQueryOrder {
+		keys = append([]string{}, r.queryKeys...)
+		sort.Strings(keys)
+	}
+	var b strings.Builder
+	write := func(s string) {
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(s)
+	}
+	for _, k := range keys {
+		if r.queryFlags[k] {
+			write(url.QueryEscape(k))
+		}
+		for _, v := range r.queries[k] {
+			write(url.QueryEscape(k) + "=" + url.QueryEscape(v))
+		}
+	}
+	return b.String()
+}
+
+// addQuery adds a value to the query key
+func (r *Builder) addQuery(key string, value interface{}) {
+	if _, ok := r.queries[key]; !ok && !r.queryFlags[key] {
+		r.queryKeys = append(r.queryKeys, key)
+	}
+	r.queries[key] = append(r.queries[key], fmt.Sprint(value))
+}
+
+// setQuery replaces the values of the query key
+func (r *Builder) setQuery(key string, values ...string) {
+	if _, ok := r.queries[key]; !ok && !r.queryFlags[key] {
+		r.queryKeys = append(r.queryKeys, key)
+	}
+	delete(r.queryFlags, key)
+	r.queries[key] = values
+}
+
+// setContentType replaces the Content-Type header
+func (r *Builder) setContentType(contentType string) {
+	r.headers[headerContentType] = []string{contentType}
+}
+
+// setPayload sets an in-memory body, so each build reads it from the start
+func (r *Builder) setPayload(b []byte) {
+	if b == nil {
+		b = []byte{}
+	}
+	r.payload = b
+	r.body = nil
+	r.bodyFunc = nil
+}
+
 // Option add optional values to the Builder
 type Option func(*Builder) error
 
@@ -138,7 +685,99 @@ func WithContext(ctx context.Context) Option {
 	}
 }
 
+// WithDeadline sets an absolute time limit for the request
+// The request context is canceled when the deadline is reached
+// The context resources are kept until then, unless Release is called when the request is done
+func WithDeadline(t time.Time) Option {
+	return func(r *Builder) error {
+		r.deadline = t
+		return nil
+	}
+}
+
+// contextValue is a key value pair to store in the request context
+type contextValue struct {
+	key   interface{}
+	value interface{}
+}
+
+// ContextKey is a key for WithValue that does not collide with keys of other packages
+type ContextKey struct {
+	name string
+}
+
+// NewContextKey creates a new ContextKey
+// Each call returns a different key, even for the same name
+func NewContextKey(name string) *ContextKey {
+	return &ContextKey{name: name}
+}
+
+func (k *ContextKey) String() string {
+	return "request context key " + k.name
+}
+
+// WithValue stores a value in the request context
+// It is a channel to send hints, like a priority, to custom transports
+// Example:
+// 			var priorityKey = NewContextKey("priority")
+// 			...
+// 			WithValue(priorityKey, 10)
+// 			...
+// 			priority := req.Context().Value(priorityKey)
+func WithValue(key, value interface{}) Option {
+	return func(r *Builder) error {
+		r.values = append(r.values, contextValue{key: key, value: value})
+		return nil
+	}
+}
+
+// unixSocketKey is the context key of the unix socket path
+var unixSocketKey = NewContextKey("unix socket")
+
+// WithUnixSocket stores in the request context the unix socket to dial
+// The host of the request is kept, and should be a placeholder like "localhost"
+// It must be paired with a transport that dials the socket read by UnixSocketFrom
+// Example:
+// 			transport := &http.Transport{
+// 				DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+// 					if socket, ok := UnixSocketFrom(ctx); ok {
+// 						return net.Dial("unix", socket)
+// 					}
+// 					return net.Dial("tcp", addr)
+// 				},
+// 			}
+// 			...
+// 			req, err := New("localhost", WithUnixSocket("/var/run/docker.sock"), WithPath("/containers/json"))
+func WithUnixSocket(path string) Option {
+	return WithValue(unixSocketKey, path)
+}
+
+// UnixSocketFrom returns the unix socket set with WithUnixSocket
+func UnixSocketFrom(ctx context.Context) (string, bool) {
+	path, ok := ctx.Value(unixSocketKey).(string)
+	return path, ok
+}
+
+// scopesKey is the context key of the auth scopes
+var scopesKey = NewContextKey("scopes")
+
+// Scopes stores in the request context the OAuth scopes the request needs
+// A token source, like a WebClient wrapper, reads them with ScopesFrom to fetch a token with those scopes
+// Example:
+// 			req, err := New("my.host.com", WithPath("/users"), Scopes("users:read"))
+func Scopes(scopes ...string) Option {
+	return WithValue(scopesKey, append([]string{}, scopes...))
+}
+
+// ScopesFrom returns the scopes set with Scopes
+func ScopesFrom(ctx context.Context) []string {
+	scopes, _ := ctx.Value(scopesKey).([]string)
+	return scopes
+}
+
 // WithProtocol specify the protocol for the Builder
+// It is ignored when the host already has a scheme, like https://my.host.com
+// An empty protocol falls back to the default http
 func WithProtocol(protocol string) Option {
 	return func(r *Builder) error {
 		r.protocol = protocol
@@ -146,6 +785,20 @@ func WithProtocol(protocol string) Option {
 	}
 }
 
+// Protocol is an alias of WithProtocol
+func Protocol(scheme string) Option {
+	return WithProtocol(scheme)
+}
+
+// RequireHTTPS makes the build fail with ErrInsecureScheme if the url scheme is not https
+// It prevents sending credentials over plaintext connections
+func RequireHTTPS() Option {
+	return func(r *Builder) error {
+		r.requireHTTPS = true
+		return nil
+	}
+}
+
 // WithMethod specify the http method for the Builder
 func WithMethod(method httpMethod) Option {
 	return func(r *Builder) error {
@@ -154,39 +807,133 @@ func WithMethod(method httpMethod) Option {
 	}
 }
 
+// WithAllowCustomMethod accepts methods other than the ones in methods.go
+// Example:
+// 			...
+// 			WithMethod(HttpMethod("PROPFIND"))
+// 			WithAllowCustomMethod()
+// 			...
+func WithAllowCustomMethod() Option {
+	return func(r *Builder) error {
+		r.allowCustomMethod = true
+		return nil
+	}
+}
+
 // WithPath sets the path
-// To set path params, use :{value}
+// The chars not allowed in a path are percent-encoded, and the valid escapes, like %20, are kept
+// A ? starts the query of the path, sent before the queries set by the options
+// To set path params, use :{value} or {{value}}, the param values are percent-encoded
 // Example:
 // 			...
-// 			WithPath("/:userId/address/:addId")
+// 			WithPath("/:userId/address/{addId}")
 //			WithParam("userId", "123")
 //			WithParam("addId", "2")
 // 			...
 func WithPath(path string) Option {
 	return func(r *Builder) error {
 		r.path = path
+		r.rawPath = false
+		return nil
+	}
+}
+
+// NormalizeSlashes collapses the duplicated slashes of the host and path, keeping the ://
+// It guards against doubles from joined base paths or param values
+// Example:
+// 			New("my.host.com/api/", WithPath("/users//123"), NormalizeSlashes()) // http://my.host.com/api/users/123
+func NormalizeSlashes() Option {
+	return func(r *Builder) error {
+		r.normalizeSlashes = true
+		return nil
+	}
+}
+
+// WithRawPath sets a path that is already percent-encoded
+// The escapes of the path are kept, like a %2F inside a segment, and only the param values are encoded, like in WithPath
+// Example:
+// 			...
+// 			WithRawPath("/files/my%20docs/:name")
+//			WithParam("name", "a b") // /files/my%20docs/a%20b
+// 			...
+func WithRawPath(path string) Option {
+	return func(r *Builder) error {
+		r.path = path
+		r.rawPath = true
 		return nil
 	}
 }
 
 // WithParam adds a param bind
+// The value is percent-encoded, so a/b is bound as a%2Fb
 func WithParam(key string, value interface{}) Option {
 	return func(r *Builder) error {
 		r.params[key] = fmt.Sprint(value)
+		delete(r.rawParams, key)
 		return nil
 	}
 }
 
+// WithRawParam adds a param bind without percent-encoding the value
+// It is meant for values that are already encoded, or that bind more than one segment
+// Example:
+// 			...
+// 			WithPath("/files/:path")
+//			WithRawParam("path", "docs/a%20b") // /files/docs/a%20b
+// 			...
+func WithRawParam(key string, value interface{}) Option {
+	return func(r *Builder) error {
+		r.params[key] = fmt.Sprint(value)
+		if r.rawParams == nil {
+			r.rawParams = make(map[string]bool)
+		}
+		r.rawParams[key] = true
+		return nil
+	}
+}
+
+// RawParam is an alias of WithRawParam
+func RawParam(key string, value interface{}) Option {
+	return WithRawParam(key, value)
+}
+
 // WithParams sets the params
 func WithParams(params map[string]interface{}) Option {
 	return func(r *Builder) error {
 		for k, v := range params {
 			r.params[k] = fmt.Sprint(v)
+			delete(r.rawParams, k)
 		}
 		return nil
 	}
 }
 
+// WithParamsStruct sets the params from the fields of a struct with param tags
+// The values are converted like in WithParam, and pointer fields are dereferenced
+// Fields without tag, tagged with "-", nil pointers, or empty and tagged with omitempty are ignored
+// The tagged fields must be exported scalars, otherwise an error is returned
+// Example:
+// 			type GetAddress struct {
+// 				UserId    int    `param:"userId"`
+// 				AddressId string `param:"addId"`
+// 			}
+// 			...
+// 			WithPath("/:userId/address/:addId")
+// 			WithParamsStruct(GetAddress{UserId: 123, AddressId: "2"})
+// 			...
+func WithParamsStruct(v interface{}) Option {
+	return func(r *Builder) error {
+		return taggedFields(v, "param", func(name string, fv reflect.Value) error {
+			if fv.Kind() == reflect.Struct || fv.Kind() == reflect.Map || fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array {
+				return fmt.Errorf("request: param %s must be a scalar, got %s", name, fv.Kind())
+			}
+			r.params[name] = fmt.Sprint(fv.Interface())
+			delete(r.rawParams, name)
+			return nil
+		})
+	}
+}
+
 // WithHeader adds to the header a value
 // The header name will always be first letter Upper
 // Example:
@@ -200,6 +947,7 @@ func WithParams(params map[string]interface{}) Option {
 
 func WithHeader(key string, value interface{}) Option {
 	return func(r *Builder) error {
+		key = http.CanonicalHeaderKey(key)
 		if _, ok := r.headers[key]; ok {
 			r.headers[key] = append(r.headers[key], fmt.Sprint(value))
 		} else {
@@ -213,6 +961,7 @@ func WithHeader(key string, value interface{}) Option {
 func WithHeaders(headers map[string][]interface{}) Option {
 	return func(r *Builder) error {
 		for k, v := range headers {
+			k = http.CanonicalHeaderKey(k)
 			for _, hv := range v {
 				if _, ok := r.headers[k]; ok {
 					r.headers[k] = append(r.headers[k], fmt.Sprint(hv))
@@ -225,14 +974,126 @@ func WithHeaders(headers map[string][]interface{}) Option {
 	}
 }
 
+// RequireHeader makes the build fail with ErrMissingHeader if the header is not set after all options
+// Useful as a connector general option, to ensure an Authorization or tenant header is always sent
+// Headers added later, like the ones of a connector header provider, are not seen by the check
+func RequireHeader(key string) Option {
+	return func(r *Builder) error {
+		r.requiredHeaders = append(r.requiredHeaders, key)
+		return nil
+	}
+}
+
+// WithReferer sets the Referer header
+// The value must be an absolute url
+func WithReferer(u string) Option {
+	return func(r *Builder) error {
+		if err := validateAbsoluteUrl(u); err != nil {
+			return err
+		}
+		r.headers[headerReferer] = []string{u}
+		return nil
+	}
+}
+
+// WithOrigin sets the Origin header
+// The value must be only the scheme and host of an url, like https://my.host.com:8080, without path, query or fragment
+func WithOrigin(u string) Option {
+	return func(r *Builder) error {
+		if err := validateOrigin(u); err != nil {
+			return err
+		}
+		r.headers[headerOrigin] = []string{u}
+		return nil
+	}
+}
+
+func validateAbsoluteUrl(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return fmt.Errorf("request: %q is not an absolute url", u)
+	}
+	return nil
+}
+
+// validateOrigin validates an origin is only scheme://host[:port]
+func validateOrigin(u string) error {
+	if err := validateAbsoluteUrl(u); err != nil {
+		return err
+	}
+	parsed, _ := url.Parse(u)
+	if parsed.User != nil || parsed.Path != "" || parsed.RawQuery != "" || parsed.ForceQuery || parsed.Fragment != "" || strings.Contains(u, "#") {
+		return fmt.Errorf("request: %q is not an origin", u)
+	}
+	return nil
+}
+
+// WithIfMatch sets the If-Match header, for optimistic concurrency on writes
+// The etag should be sent as received in the ETag header, including the quotes
+func WithIfMatch(etag string) Option {
+	return func(r *Builder) error {
+		r.headers[headerIfMatch] = []string{etag}
+		return nil
+	}
+}
+
+// WithBasicAuth sets the Authorization header with the basic auth of user and pass, like http.Request.SetBasicAuth
+// It replaces any Authorization header set before
+func WithBasicAuth(user, pass string) Option {
+	return func(r *Builder) error {
+		r.headers[headerAuthorization] = []string{"Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))}
+		return nil
+	}
+}
+
+// BasicAuth is an alias of WithBasicAuth
+func BasicAuth(user, pass string) Option {
+	return WithBasicAuth(user, pass)
+}
+
+// WithBearerToken sets the Authorization header with the bearer token
+// It replaces any Authorization header set before, instead of adding a second value like WithHeader
+func WithBearerToken(token string) Option {
+	return func(r *Builder) error {
+		r.headers[headerAuthorization] = []string{"Bearer " + token}
+		return nil
+	}
+}
+
+// BearerToken is an alias of WithBearerToken
+func BearerToken(token string) Option {
+	return WithBearerToken(token)
+}
+
+// MethodOverride sends the request as a POST, with the X-HTTP-Method-Override header carrying the actual method
+// Useful for APIs behind proxies that only allow GET and POST
+// Example:
+// 			MethodOverride(MethodDelete)
+func MethodOverride(actual HttpMethod) Option {
+	return func(r *Builder) error {
+		r.method = MethodPost
+		r.headers[headerMethodOverride] = []string{string(actual)}
+		return nil
+	}
+}
+
+// Expect100Continue sets the Expect: 100-continue header, so the body is only sent after the server accepts the request
+// Useful for large uploads
+// The transport honors it when it has an ExpectContinueTimeout, like http.DefaultTransport, and the request has a body
+func Expect100Continue() Option {
+	return func(r *Builder) error {
+		r.headers[headerExpect] = []string{"100-continue"}
+		return nil
+	}
+}
+
 // WithQuery adds query param to the Builder
 func WithQuery(key string, value interface{}) Option {
 	return func(r *Builder) error {
-		if _, ok := r.queries[key]; ok {
-			r.queries[key] = append(r.queries[key], fmt.Sprint(value))
-		} else {
-			r.queries[key] = []string{fmt.Sprint(value)}
-		}
+		r.addQuery(key, value)
 		return nil
 	}
 }
@@ -242,21 +1103,275 @@ func WithQueries(queries map[string][]interface{}) Option {
 	return func(r *Builder) error {
 		for k, v := range queries {
 			for _, qv := range v {
-				if _, ok := r.queries[k]; ok {
-					r.queries[k] = append(r.queries[k], fmt.Sprint(qv))
-				} else {
-					r.queries[k] = []string{fmt.Sprint(qv)}
+				r.addQuery(k, qv)
+			}
+		}
+		return nil
+	}
+}
+
+// CacheBust sets the query param "_" with a unique value in each build
+// It defeats intermediary caches, useful for polling behind caching proxies
+func CacheBust() Option {
+	return CacheBustParam("_")
+}
+
+// CacheBustParam sets the given query param with a unique value in each build
+func CacheBustParam(name string) Option {
+	return func(r *Builder) error {
+		r.cacheBust = name
+		return nil
+	}
+}
+
+// cacheBustSeq makes the cache bust values unique inside the same nanosecond
+var cacheBustSeq uint64
+
+// cacheBustValue returns a value unique for each call
+func cacheBustValue() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + strconv.FormatUint(atomic.AddUint64(&cacheBustSeq, 1), 36)
+}
+
+// WithPreserveQueryOrder tells if the query keys keep the insertion order
+// By default the keys are sorted, like url.Values.Encode
+// Keeping the insertion order is useful for signatures computed over the query
+// The keys added with WithQueries have no defined order, since they come from a map
+func WithPreserveQueryOrder(preserve bool) Option {
+	return func(r *Builder) error {
+		r.preserveQueryOrder = preserve
+		return nil
+	}
+}
+
+// WithQueryFlag adds a query param without value
+// Example:
+// 			...
+// 			WithQueryFlag("pretty") // ?pretty
+// 			...
+func WithQueryFlag(key string) Option {
+	return func(r *Builder) error {
+		if _, ok := r.queries[key]; !ok && !r.queryFlags[key] {
+			r.queryKeys = append(r.queryKeys, key)
+		}
+		r.queryFlags[key] = true
+		return nil
+	}
+}
+
+// BoolMode tells how QueryBool sends a boolean query param
+type BoolMode int
+
+const (
+	// BoolValue sends key=true or key=false
+	BoolValue BoolMode = iota
+	// BoolOmitFalse sends key=true, and omits the param when false
+	BoolOmitFalse
+	// BoolFlag sends the key without value when true, and omits the param when false
+	BoolFlag
+)
+
+// QueryBool adds a boolean query param, sent accordingly to the mode
+// Example:
+// 			...
+// 			QueryBool("active", true, BoolFlag) // ?active
+// 			QueryBool("active", false, BoolOmitFalse) // no param
+// 			...
+func QueryBool(key string, v bool, mode BoolMode) Option {
+	return func(r *Builder) error {
+		if !v && mode != BoolValue {
+			return nil
+		}
+		if v && mode == BoolFlag {
+			return WithQueryFlag(key)(r)
+		}
+		r.addQuery(key, v)
+		return nil
+	}
+}
+
+// WithRawQuery sets an already encoded query, used as it is
+// It is appended after the query params of the other options
+// Example:
+// 			...
+// 			WithQuery("page", 2)
+// 			WithRawQuery("filter=name%3Djohn&sort=-date") // ?page=2&filter=name%3Djohn&sort=-date
+// 			...
+func WithRawQuery(q string) Option {
+	return func(r *Builder) error {
+		r.rawQuery = strings.TrimPrefix(q, "?")
+		return nil
+	}
+}
+
+// WithSetQuery sets the query param, replacing any value added before
+func WithSetQuery(key string, value interface{}) Option {
+	return func(r *Builder) error {
+		r.setQuery(key, fmt.Sprint(value))
+		return nil
+	}
+}
+
+// WithQueryStruct sets the query params from the fields of a struct with url tags
+// Each field replaces the values added before for the same key
+// Slices fields are added as repeated query params
+// Pointer fields are dereferenced, so optional params can be *T
+// Fields without tag, tagged with "-", nil pointers, or empty and tagged with omitempty are ignored
+// Example:
+// 			type Common struct {
+// 				ApiKey  string `url:"api_key"`
+// 				Version int    `url:"version,omitempty"`
+// 			}
+// 			...
+// 			WithQueryStruct(Common{ApiKey: "key", Version: 2})
+// 			...
+func WithQueryStruct(v interface{}) Option {
+	return func(r *Builder) error {
+		return taggedFields(v, "url", func(name string, fv reflect.Value) error {
+			if fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array {
+				values := make([]string, 0, fv.Len())
+				for j := 0; j < fv.Len(); j++ {
+					if ev, ok := deref(fv.Index(j)); ok {
+						values = append(values, fmt.Sprint(ev.Interface()))
+					}
 				}
+				r.setQuery(name, values...)
+			} else {
+				r.setQuery(name, fmt.Sprint(fv.Interface()))
+			}
+			return nil
+		})
+	}
+}
+
+// QueryJSON sets the query params from the top level fields of v encoded as json
+// It reuses the json tags, avoiding a separate url tag for simple structs
+// Arrays of scalars are added as repeated query params, and null fields are ignored
+// Nested objects can not be flattened, and return an ErrEncode
+// Example:
+// 			type Filter struct {
+// 				Name   string   `json:"name,omitempty"`
+// 				Active bool     `json:"active"`
+// 				Tags   []string `json:"tags"`
+// 			}
+// 			...
+// 			QueryJSON(Filter{Active: true, Tags: []string{"a", "b"}}) // ?active=true&tags=a&tags=b
+// 			...
+func QueryJSON(v interface{}) Option {
+	return func(r *Builder) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return wrapErr(ErrEncode, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		fields := make(map[string]interface{})
+		if err := decoder.Decode(&fields); err != nil {
+			return wrapErr(ErrEncode, err)
+		}
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			switch fv := fields[k].(type) {
+			case nil:
+			case []interface{}:
+				values := make([]string, 0, len(fv))
+				for _, item := range fv {
+					if !isJsonScalar(item) {
+						return wrapErr(ErrEncode, fmt.Errorf("query json field %s is not an array of scalars", k))
+					}
+					values = append(values, fmt.Sprint(item))
+				}
+				r.setQuery(k, values...)
+			default:
+				if !isJsonScalar(fv) {
+					return wrapErr(ErrEncode, fmt.Errorf("query json field %s is a nested object", k))
+				}
+				r.setQuery(k, fmt.Sprint(fv))
 			}
 		}
 		return nil
 	}
 }
 
+// isJsonScalar tells if a decoded json value is a string, number or bool
+func isJsonScalar(v interface{}) bool {
+	switch v.(type) {
+	case string, json.Number, bool:
+		return true
+	}
+	return false
+}
+
+// taggedFields calls f for each field of the struct v with the tag
+// Fields without tag, tagged with "-", nil pointers, or empty and tagged with omitempty are ignored
+// The pointer fields are passed dereferenced, and an unexported field with the tag returns an error
+func taggedFields(v interface{}, tag string, f func(name string, fv reflect.Value) error) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("request: %s struct must be a struct, got %T", tag, v)
+	}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		tv := rt.Field(i).Tag.Get(tag)
+		if tv == "" || tv == "-" {
+			continue
+		}
+		parts := strings.SplitN(tv, ",", 2)
+		if !rt.Field(i).IsExported() {
+			return fmt.Errorf("request: %s field %s must be exported", tag, rt.Field(i).Name)
+		}
+		if len(parts) > 1 && parts[1] == "omitempty" && rv.Field(i).IsZero() {
+			continue
+		}
+		fv, ok := deref(rv.Field(i))
+		if !ok {
+			continue
+		}
+		if err := f(parts[0], fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deref returns the value pointed by v, false if a pointer is nil
+func deref(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
 // WithBody sets the body
+// The reader is sent as it is, without being encoded or buffered, so it can stream large payloads
 func WithBody(body io.Reader) Option {
 	return func(r *Builder) error {
 		r.body = body
+		r.payload = nil
+		r.bodyFunc = nil
+		return nil
+	}
+}
+
+// Reader is an alias of WithBody
+func Reader(body io.Reader) Option {
+	return WithBody(body)
+}
+
+// WithChunked forces the body to be sent with chunked transfer encoding
+// Bodies of unknown length, like a io.Pipe, are already sent chunked
+func WithChunked() Option {
+	return func(r *Builder) error {
+		r.chunked = true
 		return nil
 	}
 }
@@ -264,7 +1379,60 @@ func WithBody(body io.Reader) Option {
 // WithString sets the body as a string
 func WithString(body string) Option {
 	return func(r *Builder) error {
-		r.body = bytes.NewBufferString(body)
+		r.setPayload([]byte(body))
+		return nil
+	}
+}
+
+// WithRaw sets an already serialized body with its Content-Type
+// The request has the ContentLength of the body, and GetBody to replay it
+// Example:
+// 			WithRaw(signedPayload, "application/json")
+func WithRaw(body []byte, contentType string) Option {
+	return func(r *Builder) error {
+		r.setContentType(contentType)
+		r.setPayload(body)
+		return nil
+	}
+}
+
+// EncoderFunc encodes a value into the body bytes
+type EncoderFunc func(v interface{}) ([]byte, error)
+
+// WithDefaultContentType sets the Content-Type of a body that has no Content-Type
+// Useful with WithBody, or as a connector general option, to never send untyped bodies
+func WithDefaultContentType(ct string) Option {
+	return func(r *Builder) error {
+		r.defaultContentType = ct
+		return nil
+	}
+}
+
+// WithCharset sets the charset param of the Content-Type header
+// It is applied when the request is built, so it works with any body option in any order
+// If there is no Content-Type header it does nothing
+// Example:
+// 			WithJson(body),
+// 			WithCharset("utf-8"), // Content-Type: application/json; charset=utf-8
+func WithCharset(cs string) Option {
+	return func(r *Builder) error {
+		r.charset = cs
+		return nil
+	}
+}
+
+// WithEncoder sets the body encoded with a custom encoder
+// This method also sets the Content-Type header with the given contentType
+// Example:
+// 			WithEncoder(msg, msgpack.Marshal, "application/msgpack")
+func WithEncoder(body interface{}, encoder EncoderFunc, contentType string) Option {
+	return func(r *Builder) error {
+		if b, err := encoder(body); err != nil {
+			return wrapErr(ErrEncode, err)
+		} else {
+			r.setContentType(contentType)
+			r.setPayload(b)
+		}
 		return nil
 	}
 }
@@ -272,27 +1440,81 @@ func WithString(body string) Option {
 // WithJson sets the body as a json
 // This method already sets the Content-Type header as application/json
 func WithJson(body interface{}) Option {
+	return WithEncoder(body, json.Marshal, "application/json")
+}
+
+// WithProto sets the body as a protobuf
+// The marshal function is injected, so the package does not depend on a protobuf library
+// This method already sets the Content-Type header as application/x-protobuf
+// Example:
+// 			WithProto[proto.Message](&user, proto.Marshal)
+func WithProto[M any](msg M, marshal func(M) ([]byte, error)) Option {
+	return WithEncoder(msg, func(interface{}) ([]byte, error) {
+		return marshal(msg)
+	}, "application/x-protobuf")
+}
+
+// BodyFunc defers the body until the request is built, encoding the produced value as a json
+// An error returned by f is returned by the build
+// Like the other body options, it replaces the body set before, and is replaced by the ones set after
+// This method already sets the Content-Type header as application/json
+// Example:
+//			BodyFunc(func() (interface{}, error) {
+//				return store.Snapshot()
+//			})
+func BodyFunc(f func() (interface{}, error)) Option {
 	return func(r *Builder) error {
-		if b, err := json.Marshal(body); err != nil {
-			return err
-		} else {
-			r.headers[headerContentType] = []string{"application/json"}
-			r.body = bytes.NewBuffer(b)
+		r.bodyFunc = f
+		r.payload = nil
+		r.body = nil
+		return nil
+	}
+}
+
+// WithJsonOptions sets the body as a json controlling the encoding
+// escapeHTML tells if the characters <, > and & should be escaped
+// indent is the indentation of each level, empty for a compact json
+// This method already sets the Content-Type header as application/json
+func WithJsonOptions(body interface{}, escapeHTML bool, indent string) Option {
+	return func(r *Builder) error {
+		b := new(bytes.Buffer)
+		enc := json.NewEncoder(b)
+		enc.SetEscapeHTML(escapeHTML)
+		enc.SetIndent("", indent)
+		if err := enc.Encode(body); err != nil {
+			return wrapErr(ErrEncode, err)
 		}
+		// the encoder always terminates the value with a new line
+		b.Truncate(b.Len() - 1)
+		r.setContentType("application/json")
+		r.setPayload(b.Bytes())
 		return nil
 	}
 }
 
-// WithXml sets the body as a xml
-// This method already sets the Content-Type header as application/xml
-func WithXml(body interface{}) Option {
+// WithTemplate sets the body rendering a text/template with the data
+// This method also sets the Content-Type header with the given contentType
+// Example:
+// 			WithTemplate(`<soap:Envelope><soap:Body><GetUser><Id>{{.Id}}</Id></GetUser></soap:Body></soap:Envelope>`,
+// 				user, "text/xml")
+func WithTemplate(tmpl string, data interface{}, contentType string) Option {
 	return func(r *Builder) error {
-		if b, err := xml.Marshal(body); err != nil {
-			return err
-		} else {
-			r.headers[headerContentType] = []string{"application/xml"}
-			r.body = bytes.NewBuffer(b)
+		t, err := template.New("body").Parse(tmpl)
+		if err != nil {
+			return wrapErr(ErrEncode, err)
+		}
+		b := new(bytes.Buffer)
+		if err := t.Execute(b, data); err != nil {
+			return wrapErr(ErrEncode, err)
 		}
+		r.setContentType(contentType)
+		r.setPayload(b.Bytes())
 		return nil
 	}
 }
+
+// WithXml sets the body as a xml
+// This method already sets the Content-Type header as application/xml
+func WithXml(body interface{}) Option {
+	return WithEncoder(body, xml.Marshal, "application/xml")
+}
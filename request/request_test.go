@@ -2,12 +2,21 @@ package request
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 const host = "defaultHost"
@@ -48,334 +57,2312 @@ func TestNewMethod(t *testing.T) {
 	}
 }
 
-func TestNewPath(t *testing.T) {
-	path := "/newpath"
-	r, err := New(host, WithPath(path))
+func TestNewCustomMethod(t *testing.T) {
+	r, err := New(host, WithMethod(HttpMethod("PROPFIND")), WithAllowCustomMethod())
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	expectedUrl := "http://" + host + path
-	if r.URL.String() != expectedUrl {
-		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+	if r.Method != "PROPFIND" {
+		t.Errorf("final method does not match: expected %s, result: %s", "PROPFIND", r.Method)
 		t.FailNow()
 	}
 }
 
-func TestNewProtocol(t *testing.T) {
-	protocol := "https"
-	r, err := New(host, WithProtocol(protocol))
-	if err != nil {
-		t.Error(err)
-		t.FailNow()
-	}
-	expectedUrl := protocol + "://" + host
-	if r.URL.String() != expectedUrl {
-		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+func TestNewCustomMethodError(t *testing.T) {
+	_, err := New(host, WithMethod(HttpMethod("PROPFIND")))
+
+	if !errors.Is(err, ErrInvalidMethod) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrInvalidMethod, err)
 		t.FailNow()
 	}
 }
 
-func TestNewCtx(t *testing.T) {
-	ctx := context.Background()
-	r, err := New(host, WithContext(ctx))
+func TestNewRequireHTTPS(t *testing.T) {
+	r, err := New(host, WithProtocol("https"), RequireHTTPS())
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	if r.Context() != ctx {
-		t.Errorf("final contexet does not match: expected %s, result: %s", ctx, r.Context())
+	if r.URL.Scheme != "https" {
+		t.Errorf("scheme does not match: expected %s, result: %s", "https", r.URL.Scheme)
 		t.FailNow()
 	}
 }
 
-func TestNewHeaders(t *testing.T) {
-	header := "Myheader"
-	headerV := "myHeaderValue"
-	headerV2 := "myHeaderValue2"
-	headerInt := "Myheaderint"
-	headerIntV := "myHeaderIntValue"
-	r, err := New(host, WithHeaders(map[string][]interface{}{
-		header:    {headerV, headerV2},
-		headerInt: {headerIntV},
-	}))
+func TestNewRequireHTTPSError(t *testing.T) {
+	_, err := New(host, RequireHTTPS())
+
+	if !errors.Is(err, ErrInsecureScheme) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrInsecureScheme, err)
+		t.FailNow()
+	}
+}
+
+func TestNewBasicAuth(t *testing.T) {
+	r, err := New(host, WithHeader("X-Tenant", "acme"), WithHeader("Authorization", "old"), BasicAuth("Aladdin", "open sesame"))
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	expectedLen := 2
-	if len(r.Header) > expectedLen {
-		t.Errorf("final headers len does not match: expected %d, result: %d", expectedLen, len(r.Header))
+	expected := "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ=="
+	if strings.Join(r.Header.Values("Authorization"), ",") != expected {
+		t.Errorf("authorization does not match: expected %s, result: %v", expected, r.Header.Values("Authorization"))
 		t.FailNow()
 	}
-
-	if r.Header[header][0] != headerV {
-		t.Errorf("final header does not match: expected %s, result: %s", headerV, r.Header[header][0])
+	if user, pass, ok := r.BasicAuth(); !ok || user != "Aladdin" || pass != "open sesame" {
+		t.Errorf("basic auth does not match: expected %s, result: %s %s", "Aladdin open sesame", user, pass)
 		t.FailNow()
 	}
-
-	if r.Header[header][1] != headerV2 {
-		t.Errorf("final header does not match: expected %s, result: %s", headerV2, r.Header[header][1])
+	if r.Header.Get("X-Tenant") != "acme" {
+		t.Errorf("header does not match: expected %s, result: %s", "acme", r.Header.Get("X-Tenant"))
 		t.FailNow()
 	}
+}
 
-	if r.Header[headerInt][0] != headerIntV {
-		t.Errorf("final header does not match: expected %s, result: %s", headerIntV, r.Header[headerInt][0])
+func TestNewBearerToken(t *testing.T) {
+	r, err := New(host, WithHeader("Authorization", "Bearer old"), BearerToken("myToken"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	values := r.Header.Values("Authorization")
+	if len(values) != 1 || values[0] != "Bearer myToken" {
+		t.Errorf("authorization does not match: expected %s, result: %v", "Bearer myToken", values)
 		t.FailNow()
 	}
 }
 
-func TestNewHeader(t *testing.T) {
-	header := "Myheader"
-	headerV := "myHeaderValue"
-	headerV2 := "myHeaderValue2"
-	headerInt := "Myheaderint"
-	headerIntV := "myHeaderIntValue"
-	r, err := New(host,
-		WithHeader(header, headerV),
-		WithHeader(header, headerV2),
-		WithHeader(headerInt, headerIntV),
-	)
+func TestNewMethodOverride(t *testing.T) {
+	r, err := New(host, MethodOverride(MethodDelete))
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	expectedLen := 2
-	if len(r.Header) > expectedLen {
-		t.Errorf("final headers len does not match: expected %d, result: %d", expectedLen, len(r.Header))
+	if r.Method != "POST" {
+		t.Errorf("final method does not match: expected %s, result: %s", "POST", r.Method)
 		t.FailNow()
 	}
-
-	if r.Header[header][0] != headerV {
-		t.Errorf("final header does not match: expected %s, result: %s", headerV, r.Header[header][0])
+	if r.Header.Get("X-HTTP-Method-Override") != "DELETE" {
+		t.Errorf("override header does not match: expected %s, result: %s", "DELETE", r.Header.Get("X-HTTP-Method-Override"))
 		t.FailNow()
 	}
+}
 
-	if r.Header[header][1] != headerV2 {
-		t.Errorf("final header does not match: expected %s, result: %s", headerV2, r.Header[header][1])
+func TestNewRequireHeader(t *testing.T) {
+	r, err := New(host, RequireHeader("X-Tenant"), WithHeader("X-Tenant", "acme"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.Header.Get("X-Tenant") != "acme" {
+		t.Errorf("header does not match: expected %s, result: %s", "acme", r.Header.Get("X-Tenant"))
 		t.FailNow()
 	}
+}
 
-	if r.Header[headerInt][0] != headerIntV {
-		t.Errorf("final header does not match: expected %s, result: %s", headerIntV, r.Header[headerInt][0])
+func TestNewRequireHeaderError(t *testing.T) {
+	_, err := New(host, RequireHeader("X-Tenant"))
+
+	if !errors.Is(err, ErrMissingHeader) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrMissingHeader, err)
 		t.FailNow()
 	}
 }
 
-func TestNewQueries(t *testing.T) {
-	query := "myQuery"
-	queryV := "queryValue"
-	queryV2 := "queryValue2"
-	queryInt := "myQueryInt"
-	queryIntV := "myQueryIntValue"
-	r, err := New(host,
-		WithQueries(map[string][]interface{}{
-			query:    {queryV, queryV2},
-			queryInt: {queryIntV},
-		}),
-	)
+func TestNewExpect100Continue(t *testing.T) {
+	r, err := New(host, WithMethod(MethodPut), WithString("large body"), Expect100Continue())
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	exp1 := "myQuery=queryValue"
-	if !strings.Contains(r.URL.String(), exp1) {
-		t.Errorf("final url does not has query: expected %s, result: %s", exp1, r.URL.String())
-		t.FailNow()
-	}
-	exp2 := "myQuery=queryValue2"
-	if !strings.Contains(r.URL.String(), exp2) {
-		t.Errorf("final url does not has query: expected %s, result: %s", exp2, r.URL.String())
+	if r.Header.Get("Expect") != "100-continue" {
+		t.Errorf("expect header does not match: expected %s, result: %s", "100-continue", r.Header.Get("Expect"))
 		t.FailNow()
 	}
-	exp3 := "myQueryInt=myQueryIntValue"
-	if !strings.Contains(r.URL.String(), exp3) {
-		t.Errorf("final url does not has query: expected %s, result: %s", exp3, r.URL.String())
+	if r.ContentLength != int64(len("large body")) {
+		t.Errorf("content length does not match: expected %d, result: %d", len("large body"), r.ContentLength)
 		t.FailNow()
 	}
 }
 
-func TestNewQuery(t *testing.T) {
-	query := "myQuery"
-	queryV := "queryValue"
-	queryV2 := "queryValue2"
-	queryInt := "myQueryInt"
-	queryIntV := "myQueryIntValue"
-	r, err := New(host,
-		WithQuery(query, queryV),
-		WithQuery(query, queryV2),
-		WithQuery(queryInt, queryIntV),
-	)
+func TestNewTraceParent(t *testing.T) {
+	r, err := New(host, TraceParent("4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true))
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	exp1 := "myQuery=queryValue"
-	if !strings.Contains(r.URL.String(), exp1) {
-		t.Errorf("final url does not has query: expected %s, result: %s", exp1, r.URL.String())
-		t.FailNow()
-	}
-	exp2 := "myQuery=queryValue2"
-	if !strings.Contains(r.URL.String(), exp2) {
-		t.Errorf("final url does not has query: expected %s, result: %s", exp2, r.URL.String())
+	expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if r.Header.Get("traceparent") != expected {
+		t.Errorf("traceparent does not match: expected %s, result: %s", expected, r.Header.Get("traceparent"))
 		t.FailNow()
 	}
-	exp3 := "myQueryInt=myQueryIntValue"
-	if !strings.Contains(r.URL.String(), exp3) {
-		t.Errorf("final url does not has query: expected %s, result: %s", exp3, r.URL.String())
+}
+
+func TestNewTraceParentError(t *testing.T) {
+	_, err := New(host, TraceParent("00000000000000000000000000000000", "00f067aa0ba902b7", false))
+	if err == nil {
+		t.Error("it supposed to return an error")
 		t.FailNow()
 	}
 }
 
-func TestNewParam(t *testing.T) {
-	param := "user"
-	paramV := "userValue"
-	paramInt := "myQueryInt"
-	paramIntV := "myQueryIntValue"
-	r, err := New(host,
-		WithPath("/:"+param+"/:"+param+"/:"+paramInt),
-		WithParam(param, paramV),
-		WithParam(paramInt, paramIntV),
-	)
+func TestNewAutoTraceParent(t *testing.T) {
+	r, err := New(host, AutoTraceParent())
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	expected := "/" + paramV + "/" + paramV + "/" + paramIntV
-	if !strings.Contains(r.URL.String(), expected) {
-		t.Errorf("final url does not has params: expected %s, result: %s", expected, r.URL.String())
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) != 4 || parts[0] != "00" || !validTraceID(parts[1], 32) || !validTraceID(parts[2], 16) || parts[3] != "01" {
+		t.Errorf("traceparent does not match: expected %s, result: %s", "00-<trace>-<span>-01", r.Header.Get("traceparent"))
 		t.FailNow()
 	}
-}
 
-func TestNewParams(t *testing.T) {
-	param := "user"
-	paramV := "userValue"
-	paramInt := "myQueryInt"
-	paramIntV := "myQueryIntValue"
-	r, err := New(host,
-		WithPath("/:"+param+"/:"+param+"/:"+paramInt),
-		WithParams(map[string]interface{}{
-			param:    paramV,
-			paramInt: paramIntV,
-		}),
-	)
+	expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"
+	r, err = New(host, AutoTraceParent(), TraceParent("4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", false))
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	expected := "/" + paramV + "/" + paramV + "/" + paramIntV
-	if !strings.Contains(r.URL.String(), expected) {
-		t.Errorf("final url does not has params: expected %s, result: %s", expected, r.URL.String())
+	if r.Header.Get("traceparent") != expected {
+		t.Errorf("traceparent does not match: expected %s, result: %s", expected, r.Header.Get("traceparent"))
 		t.FailNow()
 	}
 }
 
-func TestNewBody(t *testing.T) {
-	body := "myBody"
-	buffer := bytes.NewBufferString(body)
-	r, err := New(host,
-		WithBody(buffer),
+func TestNewAliases(t *testing.T) {
+	body := func() (interface{}, error) { return map[string]int{"id": 1}, nil }
+	filter := struct {
+		Name string `json:"name"`
+	}{Name: "a"}
+	short, err := New("https://"+host,
+		Protocol("https"),
+		WithPath("/a//b"),
+		NormalizeSlashes(),
+		RequireHTTPS(),
+		WithHeader("X-Tenant", "acme"),
+		RequireHeader("X-Tenant"),
+		MethodOverride(MethodPut),
+		Expect100Continue(),
+		QueryBool("active", true, BoolFlag),
+		QueryJSON(filter),
+		BodyFunc(body),
+		TraceParent("4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true),
+		AutoTraceParent(),
+		Scopes("read"),
 	)
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	all, err := ioutil.ReadAll(r.Body)
+	long, err := New("https://"+host,
+		WithProtocol("https"),
+		WithPath("/a//b"),
+		WithNormalizeSlashes(),
+		WithRequireHTTPS(),
+		WithHeader("X-Tenant", "acme"),
+		WithRequireHeader("X-Tenant"),
+		WithMethodOverride(MethodPut),
+		WithExpect100Continue(),
+		WithQueryBool("active", true, BoolFlag),
+		WithQueryJSON(filter),
+		WithBodyFunc(body),
+		WithTraceParent("4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true),
+		WithAutoTraceParent(),
+		WithScopes("read"),
+	)
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	if body != string(all) {
-		t.Errorf("final body does not match: expected %s, result: %s", body, string(all))
+	if short.Method != long.Method || short.URL.String() != long.URL.String() {
+		t.Errorf("final request does not match: expected %s %s, result: %s %s", short.Method, short.URL, long.Method, long.URL)
+		t.FailNow()
+	}
+	if fmt.Sprint(short.Header) != fmt.Sprint(long.Header) {
+		t.Errorf("final headers does not match: expected %v, result: %v", short.Header, long.Header)
+		t.FailNow()
+	}
+	shortBody, _ := ioutil.ReadAll(short.Body)
+	longBody, _ := ioutil.ReadAll(long.Body)
+	if string(shortBody) != string(longBody) {
+		t.Errorf("final body does not match: expected %s, result: %s", string(shortBody), string(longBody))
+		t.FailNow()
+	}
+	if strings.Join(ScopesFrom(long.Context()), ",") != "read" {
+		t.Errorf("final scopes does not match: expected %s, result: %v", "read", ScopesFrom(long.Context()))
+		t.FailNow()
+	}
+
+	short, _ = New(host, CacheBustParam("nocache"))
+	long, _ = New(host, WithCacheBustParam("nocache"))
+	if short.URL.Query().Get("nocache") == "" || long.URL.Query().Get("nocache") == "" {
+		t.Errorf("cache bust does not match: result: %s and %s", short.URL, long.URL)
+		t.FailNow()
+	}
+	long, _ = New(host, WithCacheBust())
+	if long.URL.Query().Get("_") == "" {
+		t.Errorf("cache bust does not match: result: %s", long.URL)
 		t.FailNow()
 	}
 }
 
-func TestNewString(t *testing.T) {
-	body := "myBody"
-	r, err := New(host,
-		WithString(body),
-	)
+func TestNewPath(t *testing.T) {
+	path := "/newpath"
+	r, err := New(host, WithPath(path))
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	all, err := ioutil.ReadAll(r.Body)
+	expectedUrl := "http://" + host + path
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+		t.FailNow()
+	}
+}
+
+func TestNewProtocolAlias(t *testing.T) {
+	r, err := New(host, Protocol("https"))
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	if body != string(all) {
-		t.Errorf("final body does not match: expected %s, result: %s", body, string(all))
+	expectedUrl := "https://" + host
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
 		t.FailNow()
 	}
 }
 
-func TestNewJson(t *testing.T) {
-	body := struct {
-		Field string `json:"field"`
-	}{Field: "myField"}
-
-	r, err := New(host,
-		WithJson(body),
-	)
+func TestNewProtocolHostWithScheme(t *testing.T) {
+	r, err := New("https://"+host+"/", WithProtocol("http"), WithPath("/a//b"), NormalizeSlashes())
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	all, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		t.Error(err)
+	expectedUrl := "https://" + host + "/a/b"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
 		t.FailNow()
 	}
+}
 
-	marshal, _ := json.Marshal(body)
-
-	if string(marshal) != string(all) {
-		t.Errorf("final body does not match: expected %s, result: %s", string(marshal), string(all))
+func TestNewProtocolEmpty(t *testing.T) {
+	r, err := New(host, WithProtocol(""))
+	if err != nil {
+		t.Error(err)
 		t.FailNow()
 	}
-
-	if r.Header[headerContentType][0] != "application/json" {
-		t.Errorf("final header does not match: expected %s, result: %s", "application/json", r.Header[headerContentType][0])
+	expectedUrl := "http://" + host
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
 		t.FailNow()
 	}
 }
 
-func TestNewXml(t *testing.T) {
-	body := struct {
-		XMLName xml.Name `xml:"obj"`
-		Field   string   `xml:"field"`
-	}{Field: "myField"}
-
-	r, err := New(host,
-		WithXml(body),
-	)
+func TestNewNormalizeSlashes(t *testing.T) {
+	r, err := New(host+"/", WithPath("/a//b"), WithQuery("next", "x//y"), NormalizeSlashes())
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	all, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		t.Error(err)
+	expectedUrl := "http://" + host + "/a/b?next=x%2F%2Fy"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
 		t.FailNow()
 	}
+}
 
-	marshal, _ := xml.Marshal(body)
-
-	if string(marshal) != string(all) {
-		t.Errorf("final body does not match: expected %s, result: %s", string(marshal), string(all))
+func TestNewProtocol(t *testing.T) {
+	protocol := "https"
+	r, err := New(host, WithProtocol(protocol))
+	if err != nil {
+		t.Error(err)
 		t.FailNow()
 	}
-
-	if r.Header[headerContentType][0] != "application/xml" {
-		t.Errorf("final header does not match: expected %s, result: %s", "application/xml", r.Header[headerContentType][0])
+	expectedUrl := protocol + "://" + host
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
 		t.FailNow()
 	}
 }
 
-func TestNewJsonError(t *testing.T) {
+func TestNewCtx(t *testing.T) {
+	ctx := context.Background()
+	r, err := New(host, WithContext(ctx))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.Context() != ctx {
+		t.Errorf("final contexet does not match: expected %s, result: %s", ctx, r.Context())
+		t.FailNow()
+	}
+}
+
+func TestNewDeadline(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	r, err := New(host, WithDeadline(deadline), WithContext(context.Background()))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	result, ok := r.Context().Deadline()
+	if !ok || !result.Equal(deadline) {
+		t.Errorf("final deadline does not match: expected %s, result: %s", deadline, result)
+		t.FailNow()
+	}
+}
+
+func TestNewDeadlineRelease(t *testing.T) {
+	r, err := New(host, WithDeadline(time.Now().Add(time.Hour)), WithContext(context.Background()))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.Context().Err() != nil {
+		t.Errorf("context error does not match: expected %v, result: %v", nil, r.Context().Err())
+		t.FailNow()
+	}
+	Release(r)
+	if r.Context().Err() != context.Canceled {
+		t.Errorf("context error does not match: expected %s, result: %v", context.Canceled, r.Context().Err())
+		t.FailNow()
+	}
+}
+
+func TestNewValue(t *testing.T) {
+	priorityKey := NewContextKey("priority")
+	ctx := context.WithValue(context.Background(), NewContextKey("other"), "other")
+	r, err := New(host, WithValue(priorityKey, 10), WithContext(ctx))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.Context().Value(priorityKey) != 10 {
+		t.Errorf("final context value does not match: expected %d, result: %v", 10, r.Context().Value(priorityKey))
+		t.FailNow()
+	}
+	if r.Context().Value(NewContextKey("priority")) != nil {
+		t.Error("keys with same name should not collide")
+		t.FailNow()
+	}
+}
+
+func TestNewUnixSocket(t *testing.T) {
+	socket := "/var/run/app.sock"
+	r, err := New("localhost", WithUnixSocket(socket))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	result, ok := UnixSocketFrom(r.Context())
+	if !ok || result != socket {
+		t.Errorf("final socket does not match: expected %s, result: %s", socket, result)
+		t.FailNow()
+	}
+	if r.URL.Host != "localhost" {
+		t.Errorf("final host does not match: expected %s, result: %s", "localhost", r.URL.Host)
+		t.FailNow()
+	}
+}
+
+func TestNewScopes(t *testing.T) {
+	r, err := New(host, Scopes("users:read", "users:write"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	result := strings.Join(ScopesFrom(r.Context()), " ")
+	if result != "users:read users:write" {
+		t.Errorf("final scopes does not match: expected %s, result: %s", "users:read users:write", result)
+		t.FailNow()
+	}
+	if scopes := ScopesFrom(context.Background()); scopes != nil {
+		t.Errorf("scopes does not match: expected none, result: %v", scopes)
+		t.FailNow()
+	}
+}
+
+func TestNewHeaders(t *testing.T) {
+	header := "Myheader"
+	headerV := "myHeaderValue"
+	headerV2 := "myHeaderValue2"
+	headerInt := "Myheaderint"
+	headerIntV := "myHeaderIntValue"
+	r, err := New(host, WithHeaders(map[string][]interface{}{
+		header:    {headerV, headerV2},
+		headerInt: {headerIntV},
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedLen := 2
+	if len(r.Header) > expectedLen {
+		t.Errorf("final headers len does not match: expected %d, result: %d", expectedLen, len(r.Header))
+		t.FailNow()
+	}
+
+	if r.Header[header][0] != headerV {
+		t.Errorf("final header does not match: expected %s, result: %s", headerV, r.Header[header][0])
+		t.FailNow()
+	}
+
+	if r.Header[header][1] != headerV2 {
+		t.Errorf("final header does not match: expected %s, result: %s", headerV2, r.Header[header][1])
+		t.FailNow()
+	}
+
+	if r.Header[headerInt][0] != headerIntV {
+		t.Errorf("final header does not match: expected %s, result: %s", headerIntV, r.Header[headerInt][0])
+		t.FailNow()
+	}
+}
+
+func TestNewHeader(t *testing.T) {
+	header := "Myheader"
+	headerV := "myHeaderValue"
+	headerV2 := "myHeaderValue2"
+	headerInt := "Myheaderint"
+	headerIntV := "myHeaderIntValue"
+	r, err := New(host,
+		WithHeader(header, headerV),
+		WithHeader(header, headerV2),
+		WithHeader(headerInt, headerIntV),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedLen := 2
+	if len(r.Header) > expectedLen {
+		t.Errorf("final headers len does not match: expected %d, result: %d", expectedLen, len(r.Header))
+		t.FailNow()
+	}
+
+	if r.Header[header][0] != headerV {
+		t.Errorf("final header does not match: expected %s, result: %s", headerV, r.Header[header][0])
+		t.FailNow()
+	}
+
+	if r.Header[header][1] != headerV2 {
+		t.Errorf("final header does not match: expected %s, result: %s", headerV2, r.Header[header][1])
+		t.FailNow()
+	}
+
+	if r.Header[headerInt][0] != headerIntV {
+		t.Errorf("final header does not match: expected %s, result: %s", headerIntV, r.Header[headerInt][0])
+		t.FailNow()
+	}
+}
+
+func TestNewRefererOrigin(t *testing.T) {
+	referer := "https://my.site.com/page"
+	origin := "https://my.site.com"
+	r, err := New(host,
+		WithReferer(referer),
+		WithOrigin(origin),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.Header.Get("Referer") != referer {
+		t.Errorf("final header does not match: expected %s, result: %s", referer, r.Header.Get("Referer"))
+		t.FailNow()
+	}
+	if r.Header.Get("Origin") != origin {
+		t.Errorf("final header does not match: expected %s, result: %s", origin, r.Header.Get("Origin"))
+		t.FailNow()
+	}
+}
+
+func TestNewRefererError(t *testing.T) {
+	_, err := New(host,
+		WithReferer("not a url"),
+	)
+
+	if err == nil {
+		t.Error("it supposed to return an error")
+		t.FailNow()
+	}
+}
+
+func TestNewOriginError(t *testing.T) {
+	_, err := New(host,
+		WithOrigin("://missing-scheme"),
+	)
+
+	if err == nil {
+		t.Error("it supposed to return an error")
+		t.FailNow()
+	}
+}
+
+func TestNewOriginNotOrigin(t *testing.T) {
+	for _, origin := range []string{"https://a.com/path?q", "https://a.com/", "https://a.com?q", "https://a.com#f", "https://user@a.com"} {
+		if _, err := New(host, WithOrigin(origin)); err == nil {
+			t.Errorf("it supposed to return an error for %s", origin)
+			t.FailNow()
+		}
+	}
+	origin := "https://a.com:8443"
+	r, err := New(host, WithOrigin(origin))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.Header.Get("Origin") != origin {
+		t.Errorf("final header does not match: expected %s, result: %s", origin, r.Header.Get("Origin"))
+		t.FailNow()
+	}
+}
+
+func TestNewIfMatch(t *testing.T) {
+	etag := `"33a64df5"`
+	r, err := New(host, WithMethod(MethodPut), WithIfMatch(etag))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.Header.Get("If-Match") != etag {
+		t.Errorf("final header does not match: expected %s, result: %s", etag, r.Header.Get("If-Match"))
+		t.FailNow()
+	}
+}
+
+func TestNewQueries(t *testing.T) {
+	query := "myQuery"
+	queryV := "queryValue"
+	queryV2 := "queryValue2"
+	queryInt := "myQueryInt"
+	queryIntV := "myQueryIntValue"
+	r, err := New(host,
+		WithQueries(map[string][]interface{}{
+			query:    {queryV, queryV2},
+			queryInt: {queryIntV},
+		}),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	exp1 := "myQuery=queryValue"
+	if !strings.Contains(r.URL.String(), exp1) {
+		t.Errorf("final url does not has query: expected %s, result: %s", exp1, r.URL.String())
+		t.FailNow()
+	}
+	exp2 := "myQuery=queryValue2"
+	if !strings.Contains(r.URL.String(), exp2) {
+		t.Errorf("final url does not has query: expected %s, result: %s", exp2, r.URL.String())
+		t.FailNow()
+	}
+	exp3 := "myQueryInt=myQueryIntValue"
+	if !strings.Contains(r.URL.String(), exp3) {
+		t.Errorf("final url does not has query: expected %s, result: %s", exp3, r.URL.String())
+		t.FailNow()
+	}
+}
+
+func TestNewQuery(t *testing.T) {
+	query := "myQuery"
+	queryV := "queryValue"
+	queryV2 := "queryValue2"
+	queryInt := "myQueryInt"
+	queryIntV := "myQueryIntValue"
+	r, err := New(host,
+		WithQuery(query, queryV),
+		WithQuery(query, queryV2),
+		WithQuery(queryInt, queryIntV),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	exp1 := "myQuery=queryValue"
+	if !strings.Contains(r.URL.String(), exp1) {
+		t.Errorf("final url does not has query: expected %s, result: %s", exp1, r.URL.String())
+		t.FailNow()
+	}
+	exp2 := "myQuery=queryValue2"
+	if !strings.Contains(r.URL.String(), exp2) {
+		t.Errorf("final url does not has query: expected %s, result: %s", exp2, r.URL.String())
+		t.FailNow()
+	}
+	exp3 := "myQueryInt=myQueryIntValue"
+	if !strings.Contains(r.URL.String(), exp3) {
+		t.Errorf("final url does not has query: expected %s, result: %s", exp3, r.URL.String())
+		t.FailNow()
+	}
+}
+
+func TestNewQueryEscape(t *testing.T) {
+	queries := map[string]string{
+		"search term": "a b&c=d",
+		"token":       "x+y/z==",
+		"fragment":    "#top?",
+		"name":        "joão",
+	}
+	options := make([]Option, 0, len(queries))
+	for k, v := range queries {
+		options = append(options, WithQuery(k, v))
+	}
+	r, err := New(host, options...)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	result := r.URL.Query()
+	for k, v := range queries {
+		if result.Get(k) != v {
+			t.Errorf("query %s does not match: expected %s, result: %s", k, v, result.Get(k))
+			t.FailNow()
+		}
+	}
+	if r.URL.Fragment != "" {
+		t.Errorf("final url should not have fragment: result: %s", r.URL.Fragment)
+		t.FailNow()
+	}
+}
+
+func TestNewQueryOrder(t *testing.T) {
+	options := []Option{
+		WithQuery("zeta", "1"),
+		WithQuery("alpha", "2"),
+		WithQuery("zeta", "3"),
+		WithQuery("mid", "a b&c=d"),
+	}
+	r, err := New(host, append(options, WithPreserveQueryOrder(true))...)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "zeta=1&zeta=3&alpha=2&mid=a+b%26c%3Dd"
+	if r.URL.RawQuery != expected {
+		t.Errorf("final query does not match: expected %s, result: %s", expected, r.URL.RawQuery)
+		t.FailNow()
+	}
+
+	r, err = New(host, append(options, WithPreserveQueryOrder(false))...)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected = "alpha=2&mid=a+b%26c%3Dd&zeta=1&zeta=3"
+	if r.URL.RawQuery != expected {
+		t.Errorf("final query does not match: expected %s, result: %s", expected, r.URL.RawQuery)
+		t.FailNow()
+	}
+}
+
+func TestNewQueryFlag(t *testing.T) {
+	r, err := New(host,
+		WithQueryFlag("pretty"),
+		WithQuery("page", 2),
+		WithQueryFlag("compact"),
+		WithPreserveQueryOrder(true),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "pretty&page=2&compact"
+	if r.URL.RawQuery != expected {
+		t.Errorf("final query does not match: expected %s, result: %s", expected, r.URL.RawQuery)
+		t.FailNow()
+	}
+}
+
+func TestNewRawQuery(t *testing.T) {
+	raw := "filter=name%3Djohn&sort=-date&sig=a%2Bb"
+	r, err := New(host, WithRawQuery(raw))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.URL.RawQuery != raw {
+		t.Errorf("final query does not match: expected %s, result: %s", raw, r.URL.RawQuery)
+		t.FailNow()
+	}
+
+	r, err = New(host, WithRawQuery("?"+raw), WithQuery("page", 2))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "page=2&" + raw
+	if r.URL.RawQuery != expected {
+		t.Errorf("final query does not match: expected %s, result: %s", expected, r.URL.RawQuery)
+		t.FailNow()
+	}
+}
+
+func TestNewSetQuery(t *testing.T) {
+	r, err := New(host,
+		WithQuery("myQuery", "queryValue"),
+		WithQuery("myQuery", "queryValue2"),
+		WithSetQuery("myQuery", "queryValue3"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedUrl := "http://" + host + "?myQuery=queryValue3"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+		t.FailNow()
+	}
+}
+
+func TestNewQueryStruct(t *testing.T) {
+	r, err := New(host,
+		WithQueryStruct(&struct {
+			ApiKey  string   `url:"api_key"`
+			Version int      `url:"version,omitempty"`
+			Tags    []string `url:"tag"`
+			Ignored string
+			Skipped string `url:"-"`
+		}{ApiKey: "key", Tags: []string{"a", "b"}, Ignored: "ignored", Skipped: "skipped"}),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	for _, exp := range []string{"api_key=key", "tag=a", "tag=b"} {
+		if !strings.Contains(r.URL.String(), exp) {
+			t.Errorf("final url does not has query: expected %s, result: %s", exp, r.URL.String())
+			t.FailNow()
+		}
+	}
+	for _, notExp := range []string{"version", "Ignored", "skipped"} {
+		if strings.Contains(r.URL.String(), notExp) {
+			t.Errorf("final url has unexpected query: not expected %s, result: %s", notExp, r.URL.String())
+			t.FailNow()
+		}
+	}
+}
+
+func TestNewQueryStructPointers(t *testing.T) {
+	page := 0
+	name := "a b"
+	r, err := New(host,
+		WithQueryStruct(struct {
+			Page  *int    `url:"page,omitempty"`
+			Name  *string `url:"name"`
+			Limit *int    `url:"limit"`
+			Ids   []*int  `url:"id"`
+		}{Page: &page, Name: &name, Ids: []*int{&page, nil}}),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "id=0&name=a+b&page=0"
+	if r.URL.RawQuery != expected {
+		t.Errorf("final query does not match: expected %s, result: %s", expected, r.URL.RawQuery)
+		t.FailNow()
+	}
+}
+
+func TestNewQueryStructUnexported(t *testing.T) {
+	_, err := New(host,
+		WithQueryStruct(struct {
+			page int `url:"page"`
+		}{page: 1}),
+	)
+
+	if err == nil {
+		t.Error("it supposed to return an error")
+		t.FailNow()
+	}
+}
+
+func TestNewQueryStructError(t *testing.T) {
+	_, err := New(host,
+		WithQueryStruct("not a struct"),
+	)
+
+	if err == nil {
+		t.Error("it supposed to return an error")
+		t.FailNow()
+	}
+}
+
+func TestNewParam(t *testing.T) {
+	param := "user"
+	paramV := "userValue"
+	paramInt := "myQueryInt"
+	paramIntV := "myQueryIntValue"
+	r, err := New(host,
+		WithPath("/:"+param+"/:"+param+"/:"+paramInt),
+		WithParam(param, paramV),
+		WithParam(paramInt, paramIntV),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "/" + paramV + "/" + paramV + "/" + paramIntV
+	if !strings.Contains(r.URL.String(), expected) {
+		t.Errorf("final url does not has params: expected %s, result: %s", expected, r.URL.String())
+		t.FailNow()
+	}
+}
+
+func TestNewParamBraces(t *testing.T) {
+	r, err := New(host,
+		WithPath("/users/{id}/address/:addId"),
+		WithParam("id", 7),
+		WithParam("addId", 2),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "/users/7/address/2"
+	if r.URL.Path != expected {
+		t.Errorf("final path does not match: expected %s, result: %s", expected, r.URL.Path)
+		t.FailNow()
+	}
+}
+
+func TestNewParamBracesLiteral(t *testing.T) {
+	r, err := New(host,
+		WithPath("/{}/a{b/c}/{id}"),
+		WithParam("id", "{idx}"),
+		WithParam("idx", "7"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "/{}/a{b/c}/{idx}"
+	if r.URL.Path != expected {
+		t.Errorf("final path does not match: expected %s, result: %s", expected, r.URL.Path)
+		t.FailNow()
+	}
+}
+
+func TestNewParamPrefix(t *testing.T) {
+	r, err := New(host,
+		WithPath("/:id/:idx"),
+		WithParam("id", "1"),
+		WithParam("idx", "2"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "/1/2"
+	if r.URL.Path != expected {
+		t.Errorf("final path does not match: expected %s, result: %s", expected, r.URL.Path)
+		t.FailNow()
+	}
+}
+
+func TestNewParamEscapeSpace(t *testing.T) {
+	r, err := New(host,
+		WithPath("/users/:name"),
+		WithParam("name", "John Doe"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "/users/John%20Doe"
+	if r.URL.EscapedPath() != expected {
+		t.Errorf("final path does not match: expected %s, result: %s", expected, r.URL.EscapedPath())
+		t.FailNow()
+	}
+}
+
+func TestNewParamEscapeSlash(t *testing.T) {
+	r, err := New(host,
+		WithPath("/users/:name"),
+		WithParam("name", "a/b"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "/users/a%2Fb"
+	if r.URL.EscapedPath() != expected {
+		t.Errorf("final path does not match: expected %s, result: %s", expected, r.URL.EscapedPath())
+		t.FailNow()
+	}
+}
+
+func TestNewParamEscapeUnicode(t *testing.T) {
+	r, err := New(host,
+		WithPath("/users/:name"),
+		WithParam("name", "ação"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "/users/a%C3%A7%C3%A3o"
+	if r.URL.EscapedPath() != expected {
+		t.Errorf("final path does not match: expected %s, result: %s", expected, r.URL.EscapedPath())
+		t.FailNow()
+	}
+}
+
+func TestNewParamEscapeStaticPath(t *testing.T) {
+	r, err := New(host,
+		WithPath("/my docs/:id"),
+		WithParam("id", "a/b"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedUrl := "http://" + host + "/my%20docs/a%2Fb"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+		t.FailNow()
+	}
+	expectedPath := "/my docs/a/b"
+	if r.URL.Path != expectedPath {
+		t.Errorf("final path does not match: expected %s, result: %s", expectedPath, r.URL.Path)
+		t.FailNow()
+	}
+}
+
+func TestNewRawParam(t *testing.T) {
+	r, err := New(host,
+		WithPath("/files/:path"),
+		RawParam("path", "docs/a%20b"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "/files/docs/a%20b"
+	if r.URL.EscapedPath() != expected {
+		t.Errorf("final path does not match: expected %s, result: %s", expected, r.URL.EscapedPath())
+		t.FailNow()
+	}
+}
+
+func TestNewRawParamOverride(t *testing.T) {
+	r, err := New(host,
+		WithPath("/files/:path"),
+		WithRawParam("path", "docs/a"),
+		WithParam("path", "docs/a"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "/files/docs%2Fa"
+	if r.URL.EscapedPath() != expected {
+		t.Errorf("final path does not match: expected %s, result: %s", expected, r.URL.EscapedPath())
+		t.FailNow()
+	}
+}
+
+func TestNewParamsStruct(t *testing.T) {
+	r, err := New(host,
+		WithPath("/:a/:b"),
+		WithParamsStruct(struct {
+			A int    `param:"a"`
+			B string `param:"b"`
+			C string
+		}{A: 1, B: "two", C: "ignored"}),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedUrl := "http://" + host + "/1/two"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+		t.FailNow()
+	}
+}
+
+func TestNewParamsStructError(t *testing.T) {
+	_, err := New(host,
+		WithPath("/:a"),
+		WithParamsStruct(struct {
+			A []int `param:"a"`
+		}{A: []int{1}}),
+	)
+
+	if err == nil {
+		t.Error("it supposed to return an error")
+		t.FailNow()
+	}
+}
+
+func TestNewParamsStructPointer(t *testing.T) {
+	id := "a b"
+	r, err := New(host,
+		WithPath("/:id"),
+		WithParamsStruct(struct {
+			Id *string `param:"id"`
+		}{Id: &id}),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedUrl := "http://" + host + "/a%20b"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+		t.FailNow()
+	}
+}
+
+func TestNewParamsStructNilPointer(t *testing.T) {
+	_, err := New(host,
+		WithPath("/:id"),
+		WithParamsStruct(struct {
+			Id *string `param:"id"`
+		}{}),
+	)
+
+	if !errors.Is(err, ErrUnresolvedParam) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrUnresolvedParam, err)
+		t.FailNow()
+	}
+}
+
+func TestNewParamsStructUnexported(t *testing.T) {
+	_, err := New(host,
+		WithPath("/:a"),
+		WithParamsStruct(struct {
+			a int `param:"a"`
+		}{1}),
+	)
+
+	if err == nil {
+		t.Error("it supposed to return an error")
+		t.FailNow()
+	}
+}
+
+func TestNewParamsStructPointerError(t *testing.T) {
+	_, err := New(host,
+		WithPath("/:a"),
+		WithParamsStruct(struct {
+			A *struct{ B int } `param:"a"`
+		}{A: &struct{ B int }{1}}),
+	)
+
+	if err == nil {
+		t.Error("it supposed to return an error")
+		t.FailNow()
+	}
+}
+
+func TestNewRawPath(t *testing.T) {
+	r, err := New(host,
+		WithRawPath("/files/my%20docs/:name"),
+		WithParam("name", "a b/c"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedUrl := "http://" + host + "/files/my%20docs/a%20b%2Fc"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+		t.FailNow()
+	}
+	expectedPath := "/files/my docs/a b/c"
+	if r.URL.Path != expectedPath {
+		t.Errorf("final path does not match: expected %s, result: %s", expectedPath, r.URL.Path)
+		t.FailNow()
+	}
+}
+
+func TestNewRawPathEscapes(t *testing.T) {
+	r, err := New(host,
+		WithRawPath("/a b/%2F/x"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedUrl := "http://" + host + "/a%20b/%2F/x"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+		t.FailNow()
+	}
+	expectedPath := "/a b///x"
+	if r.URL.Path != expectedPath {
+		t.Errorf("final path does not match: expected %s, result: %s", expectedPath, r.URL.Path)
+		t.FailNow()
+	}
+}
+
+func TestNewPathPercent(t *testing.T) {
+	r, err := New(host,
+		WithPath("/files/my%20docs/a b/100%/%zz"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedUrl := "http://" + host + "/files/my%20docs/a%20b/100%25/%25zz"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+		t.FailNow()
+	}
+	expectedPath := "/files/my docs/a b/100%/%zz"
+	if r.URL.Path != expectedPath {
+		t.Errorf("final path does not match: expected %s, result: %s", expectedPath, r.URL.Path)
+		t.FailNow()
+	}
+}
+
+func TestNewPathQuery(t *testing.T) {
+	r, err := New(host,
+		WithPath("/users/:id?a=1#top"),
+		WithParam("id", "a?b"),
+		WithQuery("b", "2"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedUrl := "http://" + host + "/users/a%3Fb?a=1&b=2"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+		t.FailNow()
+	}
+}
+
+func TestNewParams(t *testing.T) {
+	param := "user"
+	paramV := "userValue"
+	paramInt := "myQueryInt"
+	paramIntV := "myQueryIntValue"
+	r, err := New(host,
+		WithPath("/:"+param+"/:"+param+"/:"+paramInt),
+		WithParams(map[string]interface{}{
+			param:    paramV,
+			paramInt: paramIntV,
+		}),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "/" + paramV + "/" + paramV + "/" + paramIntV
+	if !strings.Contains(r.URL.String(), expected) {
+		t.Errorf("final url does not has params: expected %s, result: %s", expected, r.URL.String())
+		t.FailNow()
+	}
+}
+
+func TestNewBody(t *testing.T) {
+	body := "myBody"
+	buffer := bytes.NewBufferString(body)
+	r, err := New(host,
+		WithBody(buffer),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if body != string(all) {
+		t.Errorf("final body does not match: expected %s, result: %s", body, string(all))
+		t.FailNow()
+	}
+}
+
+func TestNewBodyUnknownLength(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	r, err := New(host,
+		WithBody(pr),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.ContentLength != -1 {
+		t.Errorf("final content length does not match: expected %d, result: %d", -1, r.ContentLength)
+		t.FailNow()
+	}
+}
+
+func TestNewBodyStream(t *testing.T) {
+	pr, pw := io.Pipe()
+	r, err := New(host,
+		WithMethod(MethodPut),
+		Reader(pr),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.Body != pr {
+		t.Errorf("final body does not match: expected the reader %T, result: %T", pr, r.Body)
+		t.FailNow()
+	}
+	go func() {
+		_, _ = io.WriteString(pw, `{"streamed":true}`)
+		_ = pw.Close()
+	}()
+	all, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if string(all) != `{"streamed":true}` {
+		t.Errorf("final body does not match: expected %s, result: %s", `{"streamed":true}`, string(all))
+		t.FailNow()
+	}
+}
+
+func TestNewChunked(t *testing.T) {
+	r, err := New(host,
+		WithString("myBody"),
+		WithChunked(),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.ContentLength != -1 {
+		t.Errorf("final content length does not match: expected %d, result: %d", -1, r.ContentLength)
+		t.FailNow()
+	}
+	if len(r.TransferEncoding) != 1 || r.TransferEncoding[0] != "chunked" {
+		t.Errorf("final transfer encoding does not match: expected %s, result: %v", "chunked", r.TransferEncoding)
+		t.FailNow()
+	}
+}
+
+func TestNewString(t *testing.T) {
+	body := "myBody"
+	r, err := New(host,
+		WithString(body),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if body != string(all) {
+		t.Errorf("final body does not match: expected %s, result: %s", body, string(all))
+		t.FailNow()
+	}
+}
+
+func TestNewProto(t *testing.T) {
+	type message struct {
+		Name string
+	}
+	marshal := func(m *message) ([]byte, error) {
+		return []byte("name:" + m.Name), nil
+	}
+	r, err := New(host, WithProto(&message{Name: "myName"}, marshal))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, _ := ioutil.ReadAll(r.Body)
+	if string(all) != "name:myName" {
+		t.Errorf("final body does not match: expected %s, result: %s", "name:myName", string(all))
+		t.FailNow()
+	}
+	if r.Header.Get(headerContentType) != "application/x-protobuf" {
+		t.Errorf("content type does not match: expected %s, result: %s", "application/x-protobuf", r.Header.Get(headerContentType))
+		t.FailNow()
+	}
+}
+
+func TestNewProtoError(t *testing.T) {
+	marshal := func(m *struct{}) ([]byte, error) {
+		return nil, errors.New("mocked error")
+	}
+	_, err := New(host, WithProto(&struct{}{}, marshal))
+	if !errors.Is(err, ErrEncode) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrEncode, err)
+		t.FailNow()
+	}
+}
+
+func TestNewProtoNilInterface(t *testing.T) {
+	marshal := func(m fmt.Stringer) ([]byte, error) {
+		if m == nil {
+			return []byte{}, nil
+		}
+		return []byte(m.String()), nil
+	}
+	r, err := New(host, WithProto[fmt.Stringer](nil, marshal))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, _ := ioutil.ReadAll(r.Body)
+	if len(all) != 0 {
+		t.Errorf("final body does not match: expected empty, result: %s", string(all))
+		t.FailNow()
+	}
+}
+
+func TestNewJSONEmptyAsArray(t *testing.T) {
+	type item struct {
+		Tags []string `json:"tags"`
+	}
+	body := struct {
+		Ids    []int             `json:"ids"`
+		Labels map[string]string `json:"labels"`
+		Items  []item            `json:"items"`
+		Next   *item             `json:"next"`
+		When   time.Time         `json:"when"`
+	}{Items: []item{{}}}
+
+	r, err := New(host, WithEncoder(body, JSONEmptyAsArray(), "application/json"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, _ := ioutil.ReadAll(r.Body)
+	expected := `{"ids":[],"labels":{},"items":[{"tags":[]}],"next":null,"when":"0001-01-01T00:00:00Z"}`
+	if string(all) != expected {
+		t.Errorf("final body does not match: expected %s, result: %s", expected, string(all))
+		t.FailNow()
+	}
+	if body.Ids != nil || body.Items[0].Tags != nil {
+		t.Error("original body should not be modified")
+		t.FailNow()
+	}
+}
+
+type cyclicNode struct {
+	Next     *cyclicNode `json:"next"`
+	Children []string    `json:"children"`
+}
+
+func TestNewJSONEmptyAsArrayCycle(t *testing.T) {
+	node := &cyclicNode{}
+	node.Next = node
+	_, err := New(host, WithEncoder(node, JSONEmptyAsArray(), "application/json"))
+	if !errors.Is(err, ErrEncode) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrEncode, err)
+		t.FailNow()
+	}
+}
+
+func TestNewJSONEmptyAsArrayShared(t *testing.T) {
+	shared := &cyclicNode{}
+	body := []*cyclicNode{shared, shared}
+	r, err := New(host, WithEncoder(body, JSONEmptyAsArray(), "application/json"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, _ := ioutil.ReadAll(r.Body)
+	expected := `[{"next":null,"children":[]},{"next":null,"children":[]}]`
+	if string(all) != expected {
+		t.Errorf("final body does not match: expected %s, result: %s", expected, string(all))
+		t.FailNow()
+	}
+}
+
+func TestNewBodyFunc(t *testing.T) {
+	body := struct {
+		Field string `json:"field"`
+	}{Field: "myField"}
+
+	r, err := New(host,
+		BodyFunc(func() (interface{}, error) {
+			return body, nil
+		}),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	marshal, _ := json.Marshal(body)
+
+	if string(marshal) != string(all) {
+		t.Errorf("final body does not match: expected %s, result: %s", string(marshal), string(all))
+		t.FailNow()
+	}
+
+	if r.Header.Get(headerContentType) != "application/json" {
+		t.Errorf("content type does not match: expected %s, result: %s", "application/json", r.Header.Get(headerContentType))
+		t.FailNow()
+	}
+}
+
+func TestNewBodyFuncError(t *testing.T) {
+	mockedErr := errors.New("mocked error")
+	_, err := New(host,
+		BodyFunc(func() (interface{}, error) {
+			return nil, mockedErr
+		}),
+	)
+	if !errors.Is(err, mockedErr) {
+		t.Errorf("error does not match: expected %s, result: %v", mockedErr, err)
+		t.FailNow()
+	}
+}
+
+func TestNewBodyFuncReplaced(t *testing.T) {
+	r, err := New(host,
+		BodyFunc(func() (interface{}, error) {
+			return map[string]string{"field": "myField"}, nil
+		}),
+		WithString("x"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if string(all) != "x" {
+		t.Errorf("final body does not match: expected %s, result: %s", "x", string(all))
+		t.FailNow()
+	}
+}
+
+func TestNewBodyFuncReplaces(t *testing.T) {
+	r, err := New(host,
+		WithString("x"),
+		BodyFunc(func() (interface{}, error) {
+			return map[string]string{"field": "myField"}, nil
+		}),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := `{"field":"myField"}`
+	if string(all) != expected {
+		t.Errorf("final body does not match: expected %s, result: %s", expected, string(all))
+		t.FailNow()
+	}
+}
+
+func TestNewQueryBool(t *testing.T) {
+	r, err := New(host, QueryBool("active", true, BoolValue), QueryBool("deleted", false, BoolValue))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.URL.RawQuery != "active=true&deleted=false" {
+		t.Errorf("final query does not match: expected %s, result: %s", "active=true&deleted=false", r.URL.RawQuery)
+		t.FailNow()
+	}
+}
+
+func TestNewQueryBoolOmitFalse(t *testing.T) {
+	r, err := New(host, QueryBool("active", true, BoolOmitFalse), QueryBool("deleted", false, BoolOmitFalse))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.URL.RawQuery != "active=true" {
+		t.Errorf("final query does not match: expected %s, result: %s", "active=true", r.URL.RawQuery)
+		t.FailNow()
+	}
+}
+
+func TestNewQueryBoolFlag(t *testing.T) {
+	r, err := New(host, QueryBool("active", true, BoolFlag), QueryBool("deleted", false, BoolFlag))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.URL.RawQuery != "active" {
+		t.Errorf("final query does not match: expected %s, result: %s", "active", r.URL.RawQuery)
+		t.FailNow()
+	}
+}
+
+func TestNewBuilder(t *testing.T) {
+	b, err := NewBuilder(host, WithPath("/users/:id"), WithParam("id", 1))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	r, err := b.Build()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedUrl := "http://" + host + "/users/1"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+		t.FailNow()
+	}
+}
+
+func TestNewBuilderBuildTwice(t *testing.T) {
+	b, err := NewBuilder(host, WithMethod(MethodPost), WithString("payload"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	for i := 0; i < 2; i++ {
+		r, err := b.Build()
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if r.ContentLength != int64(len("payload")) {
+			t.Errorf("content length does not match: expected %d, result: %d", len("payload"), r.ContentLength)
+			t.FailNow()
+		}
+		all, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if string(all) != "payload" {
+			t.Errorf("final body does not match: expected %s, result: %s", "payload", string(all))
+			t.FailNow()
+		}
+	}
+}
+
+func TestNewBuilderSnapshot(t *testing.T) {
+	b, err := NewBuilder(host, WithPath("/users/:id"), WithParam("id", 1), WithHeader("X-Base", "base"), WithQuery("page", 1))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	restore := b.Snapshot()
+	err = b.Apply(
+		WithParam("id", 2),
+		WithHeader("X-Base", "changed"),
+		WithHeader("X-Experiment", "on"),
+		WithQuery("page", 2),
+		WithQueryFlag("debug"),
+		WithString("body"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	changed, err := b.Build()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if changed.Header.Get("X-Experiment") != "on" || changed.URL.Path != "/users/2" {
+		t.Errorf("changed request does not match: result: %s %v", changed.URL, changed.Header)
+		t.FailNow()
+	}
+
+	restore()
+	r, err := b.Build()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedUrl := "http://" + host + "/users/1?page=1"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+		t.FailNow()
+	}
+	if r.Header.Get("X-Experiment") != "" || strings.Join(r.Header.Values("X-Base"), ",") != "base" {
+		t.Errorf("final headers does not match: expected %s, result: %v", "X-Base: base", r.Header)
+		t.FailNow()
+	}
+	if r.Body != nil {
+		t.Error("final body should be empty")
+		t.FailNow()
+	}
+}
+
+func TestNewBuilderSnapshotBody(t *testing.T) {
+	b, err := NewBuilder(host, WithMethod(MethodPost), WithString("base body"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	restore := b.Snapshot()
+	for i := 0; i < 2; i++ {
+		r, err := b.Build()
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		all, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if string(all) != "base body" {
+			t.Errorf("final body does not match: expected %s, result: %s", "base body", string(all))
+			t.FailNow()
+		}
+		restore()
+	}
+}
+
+func TestNewBuilderCacheKey(t *testing.T) {
+	first, err := NewBuilder(host,
+		WithPath("/users//:id"),
+		WithParam("id", 1),
+		WithQuery("b", 2),
+		WithQuery("a", "y"),
+		WithQuery("a", "x"),
+		WithQueryFlag("pretty"),
+		CacheBust(),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	second, err := NewBuilder(host,
+		WithPreserveQueryOrder(true),
+		WithQueryFlag("pretty"),
+		WithQuery("a", "x"),
+		WithQuery("a", "y"),
+		WithRawQuery("b=2"),
+		WithPath("/users/:id"),
+		WithParam("id", 1),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	firstKey, err := first.CacheKey()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	secondKey, err := second.CacheKey()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "GET http://" + strings.ToLower(host) + "/users/1?a=x&a=y&b=2&pretty"
+	if firstKey != expected || secondKey != expected {
+		t.Errorf("cache keys does not match: expected %s, result: %s and %s", expected, firstKey, secondKey)
+		t.FailNow()
+	}
+}
+
+func TestNewBuilderCacheKeyError(t *testing.T) {
+	b, err := NewBuilder(host, WithPath("/users/:id"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if _, err := b.CacheKey(); !errors.Is(err, ErrUnresolvedParam) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrUnresolvedParam, err)
+		t.FailNow()
+	}
+}
+
+type clientFunc func(*http.Request) (*http.Response, error)
+
+func (f clientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewBuilderDo(t *testing.T) {
+	b, err := NewBuilder(host, WithPath("/users/:id"), WithParam("id", 1))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	res, err := b.Do(clientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedUrl := "http://" + host + "/users/1"
+	if res.Request.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, res.Request.URL.String())
+		t.FailNow()
+	}
+}
+
+func TestNewBuilderDoTwice(t *testing.T) {
+	b, err := NewBuilder(host, WithMethod(MethodPost), WithJson(map[string]int{"a": 1}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	client := clientFunc(func(req *http.Request) (*http.Response, error) {
+		all, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader(all))}, nil
+	})
+	for i := 0; i < 2; i++ {
+		res, err := b.Do(client)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		all, _ := ioutil.ReadAll(res.Body)
+		if string(all) != `{"a":1}` {
+			t.Errorf("final body does not match: expected %s, result: %s", `{"a":1}`, string(all))
+			t.FailNow()
+		}
+	}
+}
+
+func TestNewBuilderDoDeadlineRelease(t *testing.T) {
+	b, err := NewBuilder(host, WithDeadline(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	var sent *http.Request
+	res, err := b.Do(clientFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("ok"))}, nil
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if sent.Context().Err() != nil {
+		t.Errorf("context error does not match: expected %v, result: %v", nil, sent.Context().Err())
+		t.FailNow()
+	}
+	_ = res.Body.Close()
+	if sent.Context().Err() != context.Canceled {
+		t.Errorf("context error does not match: expected %s, result: %v", context.Canceled, sent.Context().Err())
+		t.FailNow()
+	}
+}
+
+func TestNewBuilderDoBuildError(t *testing.T) {
+	b, err := NewBuilder(host, WithPath("/users/:id"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	called := false
+	_, err = b.Do(clientFunc(func(req *http.Request) (*http.Response, error) {
+		called = true
+		return nil, nil
+	}))
+	if !errors.Is(err, ErrUnresolvedParam) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrUnresolvedParam, err)
+		t.FailNow()
+	}
+	if called {
+		t.Error("client supposed to not be called")
+		t.FailNow()
+	}
+}
+
+func TestNewBuilderDoClientError(t *testing.T) {
+	b, err := NewBuilder(host)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	clientErr := errors.New("client error")
+	_, err = b.Do(clientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, clientErr
+	}))
+	if err != clientErr {
+		t.Errorf("error does not match: expected %s, result: %v", clientErr, err)
+		t.FailNow()
+	}
+}
+
+func TestNewQueryJSON(t *testing.T) {
+	filter := struct {
+		Name   string   `json:"name,omitempty"`
+		Active bool     `json:"active"`
+		Limit  int64    `json:"limit"`
+		Tags   []string `json:"tags"`
+		Next   *string  `json:"next"`
+	}{Active: true, Limit: 9007199254740993, Tags: []string{"a", "b"}}
+	r, err := New(host, QueryJSON(filter))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "active=true&limit=9007199254740993&tags=a&tags=b"
+	if r.URL.RawQuery != expected {
+		t.Errorf("final query does not match: expected %s, result: %s", expected, r.URL.RawQuery)
+		t.FailNow()
+	}
+}
+
+func TestNewQueryJSONError(t *testing.T) {
+	filter := struct {
+		Range struct {
+			From int `json:"from"`
+		} `json:"range"`
+	}{}
+	_, err := New(host, QueryJSON(filter))
+	if !errors.Is(err, ErrEncode) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrEncode, err)
+		t.FailNow()
+	}
+}
+
+func TestNewCacheBust(t *testing.T) {
+	options := []Option{WithQuery("id", 1), CacheBust()}
+	first, err := New(host, options...)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	second, err := New(host, options...)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	firstValue, secondValue := first.URL.Query().Get("_"), second.URL.Query().Get("_")
+	if firstValue == "" || firstValue == secondValue {
+		t.Errorf("cache bust values should be unique: first %s, second: %s", firstValue, secondValue)
+		t.FailNow()
+	}
+	if first.URL.Query().Get("id") != "1" {
+		t.Errorf("query does not match: expected %s, result: %s", "1", first.URL.Query().Get("id"))
+		t.FailNow()
+	}
+}
+
+func TestNewCacheBustParam(t *testing.T) {
+	r, err := New(host, CacheBustParam("nocache"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.URL.Query().Get("nocache") == "" {
+		t.Errorf("cache bust param does not match: expected %s, result: %s", "nocache", r.URL.RawQuery)
+		t.FailNow()
+	}
+}
+
+func TestNewForm(t *testing.T) {
+	r, err := New(host, WithForm(url.Values{"b": {"2"}, "a": {"1 2"}}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, _ := ioutil.ReadAll(r.Body)
+	if string(all) != "a=1+2&b=2" {
+		t.Errorf("final body does not match: expected %s, result: %s", "a=1+2&b=2", string(all))
+		t.FailNow()
+	}
+	if r.Header.Get(headerContentType) != "application/x-www-form-urlencoded" {
+		t.Errorf("content type does not match: expected %s, result: %s", "application/x-www-form-urlencoded", r.Header.Get(headerContentType))
+		t.FailNow()
+	}
+}
+
+func TestNewFormRepeatedKeys(t *testing.T) {
+	r, err := New(host, WithMethod(MethodPost), Form(url.Values{"tag": {"a", "b&c"}, "id": {"1"}}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, _ := ioutil.ReadAll(r.Body)
+	expected := "id=1&tag=a&tag=b%26c"
+	if string(all) != expected {
+		t.Errorf("final body does not match: expected %s, result: %s", expected, string(all))
+		t.FailNow()
+	}
+	if r.ContentLength != int64(len(expected)) {
+		t.Errorf("content length does not match: expected %d, result: %d", len(expected), r.ContentLength)
+		t.FailNow()
+	}
+	if r.Header.Get(headerContentType) != "application/x-www-form-urlencoded" {
+		t.Errorf("content type does not match: expected %s, result: %s", "application/x-www-form-urlencoded", r.Header.Get(headerContentType))
+		t.FailNow()
+	}
+}
+
+func TestNewFormOrdered(t *testing.T) {
+	r, err := New(host, WithFormOrdered([]KV{
+		{Key: "merchant", Value: "123"},
+		{Key: "amount", Value: "10.00"},
+		{Key: "desc", Value: "a&b"},
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, _ := ioutil.ReadAll(r.Body)
+	expected := "merchant=123&amount=10.00&desc=a%26b"
+	if string(all) != expected {
+		t.Errorf("final body does not match: expected %s, result: %s", expected, string(all))
+		t.FailNow()
+	}
+}
+
+func TestNewRaw(t *testing.T) {
+	body := []byte(`{"signed":true}`)
+	r, err := New(host, WithMethod(MethodPost), WithRaw(body, "application/json"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.ContentLength != int64(len(body)) {
+		t.Errorf("content length does not match: expected %d, result: %d", len(body), r.ContentLength)
+		t.FailNow()
+	}
+	if r.Header.Get(headerContentType) != "application/json" {
+		t.Errorf("content type does not match: expected %s, result: %s", "application/json", r.Header.Get(headerContentType))
+		t.FailNow()
+	}
+	all, _ := ioutil.ReadAll(r.Body)
+	if string(all) != string(body) {
+		t.Errorf("final body does not match: expected %s, result: %s", string(body), string(all))
+		t.FailNow()
+	}
+	replay, err := r.GetBody()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, _ = ioutil.ReadAll(replay)
+	if string(all) != string(body) {
+		t.Errorf("replayed body does not match: expected %s, result: %s", string(body), string(all))
+		t.FailNow()
+	}
+}
+
+func TestNewJson(t *testing.T) {
+	body := struct {
+		Field string `json:"field"`
+	}{Field: "myField"}
+
+	r, err := New(host,
+		WithJson(body),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	marshal, _ := json.Marshal(body)
+
+	if string(marshal) != string(all) {
+		t.Errorf("final body does not match: expected %s, result: %s", string(marshal), string(all))
+		t.FailNow()
+	}
+
+	if r.Header[headerContentType][0] != "application/json" {
+		t.Errorf("final header does not match: expected %s, result: %s", "application/json", r.Header[headerContentType][0])
+		t.FailNow()
+	}
+}
+
+func TestNewJsonContentTypeTwice(t *testing.T) {
+	r, err := New(host,
+		WithJson(map[string]int{"a": 1}),
+		WithJson(map[string]int{"b": 2}),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := []string{"application/json"}
+	if ct := r.Header.Values("Content-Type"); len(ct) != 1 || ct[0] != expected[0] {
+		t.Errorf("content type does not match: expected %v, result: %v", expected, ct)
+		t.FailNow()
+	}
+}
+
+func TestNewJsonContentTypeOtherCase(t *testing.T) {
+	r, err := New(host,
+		WithHeader("content-type", "text/plain"),
+		WithJson(map[string]int{"a": 1}),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := []string{"application/json"}
+	if ct := r.Header.Values("Content-Type"); len(ct) != 1 || ct[0] != expected[0] {
+		t.Errorf("content type does not match: expected %v, result: %v", expected, ct)
+		t.FailNow()
+	}
+}
+
+func TestNewJsonContentTypeHeaderAfter(t *testing.T) {
+	r, err := New(host,
+		WithJson(map[string]int{"a": 1}),
+		WithHeader("Content-Type", "text/plain"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := []string{"text/plain"}
+	if ct := r.Header.Values("Content-Type"); len(ct) != 1 || ct[0] != expected[0] {
+		t.Errorf("content type does not match: expected %v, result: %v", expected, ct)
+		t.FailNow()
+	}
+}
+
+func TestNewJsonContentTypeHeaderAfterOtherCase(t *testing.T) {
+	b, err := NewBuilder(host,
+		WithJson(1),
+		WithHeader("content-type", "text/plain"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	for i := 0; i < 50; i++ {
+		r, err := b.Build()
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if ct := r.Header.Values("Content-Type"); len(ct) != 1 || ct[0] != "text/plain" {
+			t.Errorf("content type does not match: expected %v, result: %v", []string{"text/plain"}, ct)
+			t.FailNow()
+		}
+	}
+}
+
+func TestNewJsonOptions(t *testing.T) {
+	body := struct {
+		Field string `json:"field"`
+	}{Field: "<myField>"}
+
+	r, err := New(host,
+		WithJsonOptions(body, false, ""),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	expected := `{"field":"<myField>"}`
+	if expected != string(all) {
+		t.Errorf("final body does not match: expected %s, result: %s", expected, string(all))
+		t.FailNow()
+	}
+
+	if r.Header[headerContentType][0] != "application/json" {
+		t.Errorf("final header does not match: expected %s, result: %s", "application/json", r.Header[headerContentType][0])
+		t.FailNow()
+	}
+}
+
+func TestNewJsonOptionsError(t *testing.T) {
+	_, err := New(host,
+		WithJsonOptions(make(chan int, 1), true, ""),
+	)
+
+	if err == nil {
+		t.Error("it supposed to return an error")
+		t.FailNow()
+	}
+}
+
+func TestNewXml(t *testing.T) {
+	body := struct {
+		XMLName xml.Name `xml:"obj"`
+		Field   string   `xml:"field"`
+	}{Field: "myField"}
+
+	r, err := New(host,
+		WithXml(body),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	marshal, _ := xml.Marshal(body)
+
+	if string(marshal) != string(all) {
+		t.Errorf("final body does not match: expected %s, result: %s", string(marshal), string(all))
+		t.FailNow()
+	}
+
+	if r.Header[headerContentType][0] != "application/xml" {
+		t.Errorf("final header does not match: expected %s, result: %s", "application/xml", r.Header[headerContentType][0])
+		t.FailNow()
+	}
+}
+
+func TestNewTemplate(t *testing.T) {
+	r, err := New(host,
+		WithTemplate("<user><id>{{.Id}}</id></user>", struct{ Id int }{Id: 7}, "text/xml"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "<user><id>7</id></user>"
+	if expected != string(all) {
+		t.Errorf("final body does not match: expected %s, result: %s", expected, string(all))
+		t.FailNow()
+	}
+	if r.Header.Get(headerContentType) != "text/xml" {
+		t.Errorf("final header does not match: expected %s, result: %s", "text/xml", r.Header.Get(headerContentType))
+		t.FailNow()
+	}
+}
+
+func TestNewTemplateError(t *testing.T) {
+	_, err := New(host,
+		WithTemplate("{{.Missing}}", struct{ Id int }{Id: 7}, "text/xml"),
+	)
+
+	if !errors.Is(err, ErrEncode) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrEncode, err)
+		t.FailNow()
+	}
+}
+
+func TestNewDefaultContentType(t *testing.T) {
+	r, err := New(host,
+		WithDefaultContentType("application/octet-stream"),
+		WithBody(bytes.NewBufferString("myBody")),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.Header.Get(headerContentType) != "application/octet-stream" {
+		t.Errorf("final header does not match: expected %s, result: %s", "application/octet-stream", r.Header.Get(headerContentType))
+		t.FailNow()
+	}
+
+	r, err = New(host,
+		WithDefaultContentType("application/octet-stream"),
+		WithJson(struct{}{}),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.Header.Get(headerContentType) != "application/json" {
+		t.Errorf("final header does not match: expected %s, result: %s", "application/json", r.Header.Get(headerContentType))
+		t.FailNow()
+	}
+}
+
+func TestNewCharset(t *testing.T) {
+	r, err := New(host,
+		WithJson(struct{}{}),
+		WithCharset("utf-8"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "application/json; charset=utf-8"
+	if r.Header.Get(headerContentType) != expected {
+		t.Errorf("final header does not match: expected %s, result: %s", expected, r.Header.Get(headerContentType))
+		t.FailNow()
+	}
+}
+
+func TestNewCharsetNoContentType(t *testing.T) {
+	r, err := New(host,
+		WithCharset("utf-8"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if _, ok := r.Header[headerContentType]; ok {
+		t.Errorf("unexpected header: result: %s", r.Header.Get(headerContentType))
+		t.FailNow()
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	encoder := func(v interface{}) ([]byte, error) {
+		return []byte(fmt.Sprintf("custom:%v", v)), nil
+	}
+	r, err := New(host,
+		WithEncoder(42, encoder, "application/x-custom"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if string(all) != "custom:42" {
+		t.Errorf("final body does not match: expected %s, result: %s", "custom:42", string(all))
+		t.FailNow()
+	}
+	if r.Header.Get(headerContentType) != "application/x-custom" {
+		t.Errorf("final header does not match: expected %s, result: %s", "application/x-custom", r.Header.Get(headerContentType))
+		t.FailNow()
+	}
+}
+
+func TestNewEncoderError(t *testing.T) {
+	_, err := New(host,
+		WithEncoder(42, func(interface{}) ([]byte, error) {
+			return nil, errors.New("mocked error")
+		}, "application/x-custom"),
+	)
+
+	if !errors.Is(err, ErrEncode) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrEncode, err)
+		t.FailNow()
+	}
+}
+
+func TestNewJsonError(t *testing.T) {
 	_, err := New(host,
 		WithJson(make(chan int, 1)),
 	)
@@ -423,3 +2410,346 @@ func TestNewRequestCtxError(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestNewErrInvalidHost(t *testing.T) {
+	_, err := New("")
+
+	if !errors.Is(err, ErrInvalidHost) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrInvalidHost, err)
+		t.FailNow()
+	}
+}
+
+func TestNewErrInvalidHostProtocol(t *testing.T) {
+	_, err := New(host, WithProtocol("ht tp"))
+
+	if !errors.Is(err, ErrInvalidHost) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrInvalidHost, err)
+		t.FailNow()
+	}
+}
+
+func TestNewErrEncode(t *testing.T) {
+	_, err := New(host, WithJson(make(chan int, 1)))
+
+	if !errors.Is(err, ErrEncode) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrEncode, err)
+		t.FailNow()
+	}
+	var jsonErr *json.UnsupportedTypeError
+	if !errors.As(err, &jsonErr) {
+		t.Errorf("error does not wrap the cause: result: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestNewErrUnresolvedParamBraces(t *testing.T) {
+	_, err := New(host,
+		WithPath("/u/{id}"),
+	)
+
+	if !errors.Is(err, ErrUnresolvedParam) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrUnresolvedParam, err)
+		t.FailNow()
+	}
+}
+
+func TestNewParamValueColon(t *testing.T) {
+	r, err := New(host,
+		WithPath("/u/:id"),
+		WithParam("id", ":x"),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "/u/:x"
+	if r.URL.Path != expected {
+		t.Errorf("final path does not match: expected %s, result: %s", expected, r.URL.Path)
+		t.FailNow()
+	}
+}
+
+func TestNewErrUnresolvedParam(t *testing.T) {
+	_, err := New(host,
+		WithPath("/:user/address/:addressId"),
+		WithParam("user", "123"),
+	)
+
+	if !errors.Is(err, ErrUnresolvedParam) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrUnresolvedParam, err)
+		t.FailNow()
+	}
+}
+
+func TestCurl(t *testing.T) {
+	r, err := New(host,
+		WithMethod(MethodPost),
+		WithPath("/users"),
+		WithHeader("Authorization", "secret"),
+		WithString(`{"name":"it's me"}`),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	cmd, err := Curl(r, false)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	for _, exp := range []string{"-X POST", "'http://" + host + "/users'", "-H 'Authorization: secret'", `--data-raw '{"name":"it'\''s me"}'`} {
+		if !strings.Contains(cmd, exp) {
+			t.Errorf("curl does not match: expected %s, result: %s", exp, cmd)
+			t.FailNow()
+		}
+	}
+	all, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if string(all) != `{"name":"it's me"}` {
+		t.Errorf("final body does not match: expected %s, result: %s", `{"name":"it's me"}`, string(all))
+		t.FailNow()
+	}
+}
+
+func TestCurlRedactAuth(t *testing.T) {
+	r, err := New(host, WithHeader("Authorization", "secret"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	cmd, err := Curl(r, true)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if strings.Contains(cmd, "secret") {
+		t.Errorf("curl has the authorization: result: %s", cmd)
+		t.FailNow()
+	}
+}
+
+func TestNewMultipart(t *testing.T) {
+	fileContent := "id,name\n1,a\n"
+	r, err := New(host, WithMethod(MethodPost), Multipart(func(w *multipart.Writer) error {
+		if err := w.WriteField("name", "report"); err != nil {
+			return err
+		}
+		fw, err := w.CreateFormFile("file", "report.csv")
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(fw, fileContent)
+		return err
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if r.FormValue("name") != "report" {
+		t.Errorf("field does not match: expected %s, result: %s", "report", r.FormValue("name"))
+		t.FailNow()
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, _ := ioutil.ReadAll(file)
+	if header.Filename != "report.csv" || string(all) != fileContent {
+		t.Errorf("file does not match: expected %s %q, result: %s %q", "report.csv", fileContent, header.Filename, string(all))
+		t.FailNow()
+	}
+}
+
+func TestNewMultipartError(t *testing.T) {
+	_, err := New(host, WithMultipart(func(w *multipart.Writer) error {
+		return errors.New("mocked error")
+	}))
+	if !errors.Is(err, ErrEncode) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrEncode, err)
+		t.FailNow()
+	}
+}
+
+func TestNewMultipartRelatedGzip(t *testing.T) {
+	content := strings.Repeat("compressible content ", 100)
+	r, err := New(host,
+		WithMultipartRelated(
+			Part{ContentType: "application/json", Body: strings.NewReader(`{"name":"file.txt"}`)},
+			Part{ContentType: "text/plain", Body: strings.NewReader(content), Gzip: true},
+		),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	_, params, err := mime.ParseMediaType(r.Header.Get(headerContentType))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	if part, err := reader.NextPart(); err != nil || part.Header.Get("Content-Encoding") != "" {
+		t.Errorf("first part should not be compressed: %v", err)
+		t.FailNow()
+	}
+	part, err := reader.NextPart()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if part.Header.Get("Content-Encoding") != "gzip" {
+		t.Errorf("part encoding does not match: expected %s, result: %s", "gzip", part.Header.Get("Content-Encoding"))
+		t.FailNow()
+	}
+	zr, err := gzip.NewReader(part)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	all, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if string(all) != content {
+		t.Errorf("part body does not match: expected %d bytes, result: %d bytes", len(content), len(all))
+		t.FailNow()
+	}
+}
+
+func TestNewMultipartRelated(t *testing.T) {
+	jsonPart := `{"name":"file.bin"}`
+	binPart := []byte{0, 1, 2, 3}
+	r, err := New(host,
+		WithMultipartRelated(
+			Part{ContentType: "application/json", Body: strings.NewReader(jsonPart)},
+			Part{ContentType: "application/octet-stream", Body: bytes.NewReader(binPart)},
+		),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get(headerContentType))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if mediaType != "multipart/related" || params["type"] != "application/json" {
+		t.Errorf("final header does not match: result: %s", r.Header.Get(headerContentType))
+		t.FailNow()
+	}
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	expected := []struct {
+		contentType string
+		body        string
+	}{{"application/json", jsonPart}, {"application/octet-stream", string(binPart)}}
+	for _, exp := range expected {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if part.Header.Get(headerContentType) != exp.contentType {
+			t.Errorf("part header does not match: expected %s, result: %s", exp.contentType, part.Header.Get(headerContentType))
+			t.FailNow()
+		}
+		all, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if string(all) != exp.body {
+			t.Errorf("part body does not match: expected %s, result: %s", exp.body, string(all))
+			t.FailNow()
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("expected end of parts, result: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestNewMultipartRelatedError(t *testing.T) {
+	_, err := New(host,
+		WithMultipartRelated(),
+	)
+
+	if !errors.Is(err, ErrEncode) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrEncode, err)
+		t.FailNow()
+	}
+}
+
+func TestNewFromOperation(t *testing.T) {
+	op := Operation{
+		Method:         "post",
+		PathTemplate:   "/users/:id/address",
+		DefaultHeaders: map[string][]string{"X-Api-Version": {"2"}},
+	}
+	r, err := New(host, FromOperation(op, WithParam("id", 7)))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expectedUrl := "http://" + host + "/users/7/address"
+	if r.URL.String() != expectedUrl {
+		t.Errorf("final url does not match: expected %s, result: %s", expectedUrl, r.URL.String())
+		t.FailNow()
+	}
+	if r.Method != string(MethodPost) {
+		t.Errorf("final method does not match: expected %s, result: %s", MethodPost, r.Method)
+		t.FailNow()
+	}
+	if r.Header.Get("X-Api-Version") != "2" {
+		t.Errorf("final header does not match: expected %s, result: %s", "2", r.Header.Get("X-Api-Version"))
+		t.FailNow()
+	}
+}
+
+func TestNewFromOperationError(t *testing.T) {
+	_, err := New(host, FromOperation(Operation{PathTemplate: "/users"}, WithJson(make(chan int))))
+
+	if !errors.Is(err, ErrEncode) {
+		t.Errorf("error does not match: expected %s, result: %v", ErrEncode, err)
+		t.FailNow()
+	}
+}
+
+func TestDumpBody(t *testing.T) {
+	body := "myBody"
+	for _, reader := range []io.Reader{bytes.NewBufferString(body), ioutil.NopCloser(strings.NewReader(body))} {
+		r, err := New(host, WithMethod(MethodPost), WithBody(reader))
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		dumped, err := DumpBody(r)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if string(dumped) != body {
+			t.Errorf("dumped body does not match: expected %s, result: %s", body, string(dumped))
+			t.FailNow()
+		}
+		all, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if string(all) != body {
+			t.Errorf("final body does not match: expected %s, result: %s", body, string(all))
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package request
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// headerTraceParent is the W3C trace context header
+const headerTraceParent = "Traceparent"
+
+// TraceParent sets the W3C traceparent header, propagating the trace without a tracing library
+// traceID has 32 and spanID has 16 lowercase hex characters, not all zeros
+// Example:
+// 			TraceParent("4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true) // 00-4bf9...4736-00f0...02b7-01
+func TraceParent(traceID, spanID string, sampled bool) Option {
+	return func(r *Builder) error {
+		if !validTraceID(traceID, 32) {
+			return fmt.Errorf("request: invalid trace id %q", traceID)
+		}
+		if !validTraceID(spanID, 16) {
+			return fmt.Errorf("request: invalid span id %q", spanID)
+		}
+		r.headers[headerTraceParent] = []string{formatTraceParent(traceID, spanID, sampled)}
+		return nil
+	}
+}
+
+// AutoTraceParent generates a sampled traceparent header with random ids in each build, when it has none
+func AutoTraceParent() Option {
+	return func(r *Builder) error {
+		r.autoTraceParent = true
+		return nil
+	}
+}
+
+// newTraceParent returns a sampled traceparent with random ids
+func newTraceParent() (string, error) {
+	ids := make([]byte, 24)
+	if _, err := rand.Read(ids); err != nil {
+		return "", err
+	}
+	return formatTraceParent(hex.EncodeToString(ids[:16]), hex.EncodeToString(ids[16:]), true), nil
+}
+
+func formatTraceParent(traceID, spanID string, sampled bool) string {
+	flags := "00"
+	if sampled {
+		flags = "01"
+	}
+	return "00-" + traceID + "-" + spanID + "-" + flags
+}
+
+// validTraceID tells if id has size lowercase hex characters, not all zeros
+func validTraceID(id string, size int) bool {
+	if len(id) != size || strings.Trim(id, "0") == "" {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -4,16 +4,71 @@
 package response
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"time"
 )
 
 // Response holds data of the http response
 type Response struct {
 	// HttpResponse the original response
 	HttpResponse *http.Response
+	// charsetDecoder converts the body to UTF-8
+	charsetDecoder CharsetDecoder
+}
+
+// CharsetDecoder converts a reader of the given charset into a UTF-8 reader
+// It allows the usage of any charset library without adding it as dependency
+// Example:
+//		func(charset string, r io.Reader) (io.Reader, error) {
+//			enc, err := htmlindex.Get(charset)
+//			if err != nil {
+//				return nil, err
+//			}
+//			return enc.NewDecoder().Reader(r), nil
+//		}
+type CharsetDecoder func(charset string, r io.Reader) (io.Reader, error)
+
+// readBody reads the body, converting it to UTF-8 when the Content-Type declares other charset
+// It returns if the body was converted
+func (r Response) readBody() ([]byte, bool, error) {
+	var body io.Reader = r.HttpResponse.Body
+	converted := false
+	if r.charsetDecoder != nil {
+		if _, params, err := mime.ParseMediaType(r.HttpResponse.Header.Get("Content-Type")); err == nil {
+			if cs := strings.ToLower(params["charset"]); cs != "" && cs != "utf-8" && cs != "utf8" {
+				if body, err = r.charsetDecoder(cs, body); err != nil {
+					return nil, false, err
+				}
+				converted = true
+			}
+		}
+	}
+	data, err := ioutil.ReadAll(body)
+	return data, converted, err
+}
+
+// ResponseMeta holds the wire level data of the http response
+type ResponseMeta struct {
+	// StatusCode is the status code, like 200
+	StatusCode int
+	// Status is the status line, like "200 OK"
+	Status string
+	// Proto is the protocol, like "HTTP/1.1"
+	Proto string
+	// ContentLength is the length of the body, -1 if unknown
+	ContentLength int64
 }
 
 // Responder holds data about which function it should respond for reach http status
@@ -22,6 +77,23 @@ type Responder struct {
 	responders map[int]Func
 	// defResponder has the default func handler
 	defResponder Func
+	// recoverPanics tells if panics inside the handlers should be returned as errors
+	recoverPanics bool
+	// charsetDecoder converts non UTF-8 bodies for ForString and ForXml
+	charsetDecoder CharsetDecoder
+	// chain has the responders consulted when this one has no handler for the status
+	chain []Responder
+	// hooks are called for every response before its handler, they must not consume the body
+	hooks []Func
+	// conditionals are the handlers of a status and header predicate, in registration order
+	conditionals []conditional
+}
+
+// conditional is a handler for the responses with the status and headers accepted by the predicate
+type conditional struct {
+	status    int
+	predicate func(http.Header) bool
+	f         Func
 }
 
 // Func handles a response
@@ -37,18 +109,87 @@ func (r *Responder) Respond(res *http.Response) error {
 	}
 
 	response := Response{
-		HttpResponse: res,
+		HttpResponse:   res,
+		charsetDecoder: r.charsetDecoder,
+	}
+
+	for _, hook := range r.hooks {
+		if err := r.call(hook, response); err != nil {
+			return err
+		}
+	}
+
+	if c, ok := r.matchConditional(res); ok {
+		return r.call(c.f, response)
 	}
 
 	f, ok := r.responders[res.StatusCode]
 	if ok {
-		return f(response)
+		return r.call(f, response)
 	} else if r.defResponder != nil {
-		return r.defResponder(response)
+		return r.call(r.defResponder, response)
+	}
+	for _, next := range r.chain {
+		if next.handles(res) {
+			return next.Respond(res)
+		}
 	}
 	return nil
 }
 
+// matchConditional returns the first conditional handler that accepts the response
+func (r *Responder) matchConditional(res *http.Response) (conditional, bool) {
+	for _, c := range r.conditionals {
+		if c.status == res.StatusCode && c.predicate(res.Header) {
+			return c, true
+		}
+	}
+	return conditional{}, false
+}
+
+// handles tells if the Responder has a handler for the response, including the default one
+func (r *Responder) handles(res *http.Response) bool {
+	if _, ok := r.responders[res.StatusCode]; ok || r.defResponder != nil {
+		return true
+	}
+	if _, ok := r.matchConditional(res); ok {
+		return true
+	}
+	for _, next := range r.chain {
+		if next.handles(res) {
+			return true
+		}
+	}
+	return false
+}
+
+// Chain creates a Responder that consults the responders in order
+// The first responder with a handler for the status, or with a default handler, responds
+// Its result is returned, even if it is an error, and the next responders are not consulted
+// If no responder handles the status, Respond returns nil
+// Example:
+//		common, _ := NewResponder(ForStatus(404), For(500, serverError))
+//		users, _ := NewResponder(ForJson(200, &user))
+//		responder := Chain(users, common)
+func Chain(responders ...Responder) Responder {
+	return Responder{
+		responders: make(map[int]Func),
+		chain:      responders,
+	}
+}
+
+// call executes the handler, converting panics into errors when RecoverPanics is set
+func (r *Responder) call(f Func, response Response) (err error) {
+	if r.recoverPanics {
+		defer func() {
+			if rec := recover(); rec != nil {
+				err = fmt.Errorf("response: handler panic: %v\n%s", rec, debug.Stack())
+			}
+		}()
+	}
+	return f(response)
+}
+
 // NewResponder creates a new Responder
 // Example:
 // 		func handleResponse(resp *http.Response) error {
@@ -96,6 +237,19 @@ func For(status int, f Func) Option {
 	}
 }
 
+// ForWhen specify function to handle a specific status when the predicate accepts the response headers
+// The ForWhen handlers are evaluated in registration order, before the handler of the status
+// Example:
+//		ForWhen(200, func(h http.Header) bool { return h.Get("X-Result-Type") == "user" }, decodeUser),
+//		ForWhen(200, func(h http.Header) bool { return h.Get("X-Result-Type") == "group" }, decodeGroup),
+//		For(200, decodeUnknown),
+func ForWhen(status int, predicate func(http.Header) bool, f Func) Option {
+	return func(r *Responder) error {
+		r.conditionals = append(r.conditionals, conditional{status: status, predicate: predicate, f: f})
+		return nil
+	}
+}
+
 // ForDefault specify function to handle non mapped status
 func ForDefault(f Func) Option {
 	return func(r *Responder) error {
@@ -104,6 +258,132 @@ func ForDefault(f Func) Option {
 	}
 }
 
+// RecoverPanics makes the Responder recover from panics inside the handlers
+// The panic is returned by Respond as an error with the stack trace
+func RecoverPanics() Option {
+	return func(r *Responder) error {
+		r.recoverPanics = true
+		return nil
+	}
+}
+
+// WithCharsetDecoder sets the decoder used by ForString and ForXml
+// to convert bodies with a non UTF-8 charset in the Content-Type header
+func WithCharsetDecoder(d CharsetDecoder) Option {
+	return func(r *Responder) error {
+		r.charsetDecoder = d
+		return nil
+	}
+}
+
+// ForLinks captures, for any status, the Link header (RFC 5988) as a map of rel to url
+// Example:
+//		var links map[string]string
+//		responder, _ := NewResponder(ForLinks(&links), ForJson(200, &users))
+//		...
+//		next, more := links["next"]
+func ForLinks(out *map[string]string) Option {
+	return func(r *Responder) error {
+		r.hooks = append(r.hooks, func(response Response) error {
+			*out = parseLinks(response.HttpResponse.Header.Values("Link"))
+			return nil
+		})
+		return nil
+	}
+}
+
+// parseLinks parses the values of Link headers, like <https://host/items?page=2>; rel="next"
+// A link with many rels, like rel="next last", is added for each of them
+func parseLinks(headers []string) map[string]string {
+	links := make(map[string]string)
+	for _, h := range headers {
+		for {
+			start := strings.IndexByte(h, '<')
+			if start < 0 {
+				break
+			}
+			end := strings.IndexByte(h[start:], '>')
+			if end < 0 {
+				break
+			}
+			target := h[start+1 : start+end]
+			var params []string
+			params, h = splitLinkParams(h[start+end+1:])
+			for _, param := range params {
+				kv := strings.SplitN(param, "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(kv[1]), `"`)) {
+					links[strings.ToLower(rel)] = target
+				}
+			}
+		}
+	}
+	return links
+}
+
+// splitLinkParams splits the params of a link until the comma that starts the next link
+// Separators inside quoted values are ignored
+func splitLinkParams(s string) (params []string, rest string) {
+	quoted := false
+	last := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			quoted = !quoted
+		case c == ';' && !quoted:
+			params = append(params, s[last:i])
+			last = i + 1
+		case c == ',' && !quoted:
+			return append(params, s[last:i]), s[i+1:]
+		}
+	}
+	return append(params, s[last:]), ""
+}
+
+// contextKey is the key of the values this package reads from the request context
+type contextKey struct {
+	name string
+}
+
+// elapsedKey is the context key of the time taken by the request
+var elapsedKey = &contextKey{name: "elapsed"}
+
+// ContextWithElapsed returns a context with the time taken to receive the response
+// The connector sets it in the context of the response request
+func ContextWithElapsed(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, elapsedKey, d)
+}
+
+// ElapsedFrom returns the time set with ContextWithElapsed
+func ElapsedFrom(ctx context.Context) (time.Duration, bool) {
+	d, ok := ctx.Value(elapsedKey).(time.Duration)
+	return d, ok
+}
+
+// WithSLA calls onBreach, for any status, when the response took more than max
+// The time is read from the request context, set by the connector with ContextWithElapsed
+// The response is still handled, a breach does not fail it
+// Example:
+//		WithSLA(500*time.Millisecond, func(d time.Duration) {
+//			metrics.SlowResponses.Inc()
+//		})
+func WithSLA(max time.Duration, onBreach func(time.Duration)) Option {
+	return func(r *Responder) error {
+		r.hooks = append(r.hooks, func(response Response) error {
+			if response.HttpResponse.Request == nil {
+				return nil
+			}
+			if d, ok := ElapsedFrom(response.HttpResponse.Request.Context()); ok && d > max {
+				onBreach(d)
+			}
+			return nil
+		})
+		return nil
+	}
+}
+
 // ForStatus specify that for that status, the application will do nothing
 func ForStatus(status int) Option {
 	return func(r *Responder) error {
@@ -114,11 +394,94 @@ func ForStatus(status int) Option {
 	}
 }
 
+// ForEmpty specify that for that status the response must have no body
+// The body is closed, and if it has any content an error is returned
+func ForEmpty(status int) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			body := response.HttpResponse.Body
+			if body == nil {
+				return nil
+			}
+			defer body.Close()
+			data, err := ioutil.ReadAll(body)
+			if err != nil {
+				return err
+			}
+			if len(data) > 0 {
+				return fmt.Errorf("response: expected empty body for status %d, got %d bytes", status, len(data))
+			}
+			return nil
+		}
+		return nil
+	}
+}
+
+// ForMeta specify function to handle a specific status capturing the response metadata
+func ForMeta(status int, out *ResponseMeta) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			*out = ResponseMeta{
+				StatusCode:    response.HttpResponse.StatusCode,
+				Status:        response.HttpResponse.Status,
+				Proto:         response.HttpResponse.Proto,
+				ContentLength: response.HttpResponse.ContentLength,
+			}
+			return nil
+		}
+		return nil
+	}
+}
+
+// redirectStatuses are the statuses that redirect with a Location header
+var redirectStatuses = []int{
+	http.StatusMultipleChoices,
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusSeeOther,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+}
+
+// ForRedirectLocation specify function to handle the redirect statuses capturing the Location header
+// The statuses are 300, 301, 302, 303, 307 and 308, and the ones with a handler already registered are kept
+// A relative location is resolved against the request url
+// It is meant to be used with a client that does not follow redirects
+func ForRedirectLocation(out *string) Option {
+	return func(r *Responder) error {
+		f := func(response Response) error {
+			location, err := response.HttpResponse.Location()
+			if err != nil {
+				return err
+			}
+			*out = location.String()
+			return nil
+		}
+		for _, status := range redirectStatuses {
+			if _, ok := r.responders[status]; !ok {
+				r.responders[status] = f
+			}
+		}
+		return nil
+	}
+}
+
+// ForPreconditionFailed specify function to handle the 412 status, returned when an If-Match does not match
+func ForPreconditionFailed(f func()) Option {
+	return func(r *Responder) error {
+		r.responders[http.StatusPreconditionFailed] = func(response Response) error {
+			f()
+			return nil
+		}
+		return nil
+	}
+}
+
 // ForString specify function to handle a specific status returning a parsed string
 func ForString(status int, resp *string) Option {
 	return func(r *Responder) error {
 		r.responders[status] = func(response Response) error {
-			if data, err := ioutil.ReadAll(response.HttpResponse.Body); err != nil {
+			if data, _, err := response.readBody(); err != nil {
 				return err
 			} else {
 				*resp = string(data)
@@ -129,6 +492,131 @@ func ForString(status int, resp *string) Option {
 	}
 }
 
+// ForTrailers specify function to handle a specific status capturing the trailers of the response
+// The trailers are only available after the end of the body, so the body is read to completion and closed
+func ForTrailers(status int, out *http.Header) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			if body := response.HttpResponse.Body; body != nil {
+				defer body.Close()
+				if _, err := io.Copy(ioutil.Discard, body); err != nil {
+					return err
+				}
+			}
+			*out = response.HttpResponse.Trailer.Clone()
+			return nil
+		}
+		return nil
+	}
+}
+
+// ForWriter specify function to handle a specific status streaming the body into the writer
+func ForWriter(status int, w io.Writer) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			_, err := io.Copy(w, response.HttpResponse.Body)
+			return err
+		}
+		return nil
+	}
+}
+
+// hopByHopHeaders are the headers of a single connection, not forwarded by proxies
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// ForProxy specify function to handle a specific status copying the response to w
+// The status, the headers and the body are copied, except the hop-by-hop headers
+// Example:
+//		func handler(w http.ResponseWriter, r *http.Request) {
+//			responder, _ := NewResponder(ForProxy(200, w), ForProxy(404, w))
+//			...
+//		}
+func ForProxy(status int, w http.ResponseWriter) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			res := response.HttpResponse
+			header := res.Header.Clone()
+			for _, h := range header.Values("Connection") {
+				for _, name := range strings.Split(h, ",") {
+					header.Del(strings.TrimSpace(name))
+				}
+			}
+			for _, name := range hopByHopHeaders {
+				header.Del(name)
+			}
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(res.StatusCode)
+			if res.Body == nil {
+				return nil
+			}
+			_, err := io.Copy(w, res.Body)
+			return err
+		}
+		return nil
+	}
+}
+
+// ForSSE specify function to handle a specific status reading the body as Server-Sent Events
+// onEvent is called for each event until the end of the body, an error in onEvent or the request context is done
+// The event is "message" when the frame has no event field
+// Multiple data fields of a frame are joined with new lines
+func ForSSE(status int, onEvent func(event, data string) error) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			ctx := context.Background()
+			if response.HttpResponse.Request != nil {
+				ctx = response.HttpResponse.Request.Context()
+			}
+			scanner := bufio.NewScanner(response.HttpResponse.Body)
+			event := ""
+			data := make([]string, 0)
+			for scanner.Scan() {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				line := scanner.Text()
+				if line == "" {
+					if len(data) > 0 {
+						if event == "" {
+							event = "message"
+						}
+						if err := onEvent(event, strings.Join(data, "\n")); err != nil {
+							return err
+						}
+					}
+					event = ""
+					data = data[:0]
+					continue
+				}
+				field, value := line, ""
+				if i := strings.IndexByte(line, ':'); i >= 0 {
+					field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+				}
+				switch field {
+				case "event":
+					event = value
+				case "data":
+					data = append(data, value)
+				}
+			}
+			return scanner.Err()
+		}
+		return nil
+	}
+}
+
 // ForJson specify function to handle a specific status returning a parsed json
 func ForJson(status int, int interface{}) Option {
 	return func(r *Responder) error {
@@ -143,15 +631,275 @@ func ForJson(status int, int interface{}) Option {
 	}
 }
 
-// ForXml specify function to handle a specific status returning a parsed xml
-func ForXml(status int, int interface{}) Option {
+// ForJsonTee specify function to handle a specific status returning a parsed json
+// The raw body is written to tee while it is read, like for audit logs of exactly what was decoded
+// The body is fully consumed and closed
+func ForJsonTee(status int, target interface{}, tee io.Writer) Option {
 	return func(r *Responder) error {
 		r.responders[status] = func(response Response) error {
+			defer response.HttpResponse.Body.Close()
+			if data, err := ioutil.ReadAll(io.TeeReader(response.HttpResponse.Body, tee)); err != nil {
+				return err
+			} else {
+				return json.Unmarshal(data, target)
+			}
+		}
+		return nil
+	}
+}
+
+// ForJsonRaw specify function to handle a specific status returning a parsed json and the raw body
+// The body is read once, and rawOut receives the same bytes decoded into target
+func ForJsonRaw(status int, target interface{}, rawOut *[]byte) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			data, err := ioutil.ReadAll(response.HttpResponse.Body)
+			if err != nil {
+				return err
+			}
+			*rawOut = data
+			return json.Unmarshal(data, target)
+		}
+		return nil
+	}
+}
+
+// ForJsonConcat specify function to handle a specific status decoding a stream of concatenated json values
+// For each value, newElem creates the target and collect receives it decoded
+// Example:
+//		ForJsonConcat(200,
+//			func() interface{} { return &Event{} },
+//			func(v interface{}) { events = append(events, v.(*Event)) },
+//		)
+func ForJsonConcat(status int, newElem func() interface{}, collect func(interface{})) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			decoder := json.NewDecoder(response.HttpResponse.Body)
+			for {
+				elem := newElem()
+				if err := decoder.Decode(elem); err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				collect(elem)
+			}
+		}
+		return nil
+	}
+}
+
+// ForJsonDiscriminated specify function to handle a specific status decoding a polymorphic json
+// The string value of the field selects, through factory, the target where the body is decoded
+// Example:
+//		var shape interface{}
+//		ForJsonDiscriminated(200, "type", func(typeValue string) interface{} {
+//			switch typeValue {
+//			case "circle":
+//				shape = &Circle{}
+//			case "square":
+//				shape = &Square{}
+//			}
+//			return shape
+//		})
+func ForJsonDiscriminated(status int, field string, factory func(typeValue string) interface{}) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			data, err := ioutil.ReadAll(response.HttpResponse.Body)
+			if err != nil {
+				return err
+			}
+			peek := make(map[string]json.RawMessage)
+			if err := json.Unmarshal(data, &peek); err != nil {
+				return err
+			}
+			var typeValue string
+			if raw, ok := peek[field]; !ok {
+				return fmt.Errorf("response: discriminator field %s not found", field)
+			} else if err := json.Unmarshal(raw, &typeValue); err != nil {
+				return fmt.Errorf("response: discriminator field %s is not a string: %w", field, err)
+			}
+			target := factory(typeValue)
+			if target == nil {
+				return fmt.Errorf("response: no target for %s %q", field, typeValue)
+			}
+			return json.Unmarshal(data, target)
+		}
+		return nil
+	}
+}
+
+// ForJsonFactory specify function to handle a specific status returning a parsed json
+// For each response, newTarget creates a fresh target and onDecoded receives it decoded
+// Unlike ForJson, the Responder holds no shared target and can be reused concurrently
+// Example:
+//		ForJsonFactory(200,
+//			func() interface{} { return &User{} },
+//			func(v interface{}) error { return save(v.(*User)) },
+//		)
+func ForJsonFactory(status int, newTarget func() interface{}, onDecoded func(interface{}) error) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			target := newTarget()
+			if err := json.NewDecoder(response.HttpResponse.Body).Decode(target); err != nil {
+				return err
+			}
+			return onDecoded(target)
+		}
+		return nil
+	}
+}
+
+// ForJsonOrString specify function to handle a specific status returning a parsed json
+// If the body is not a valid json, it is returned as a string in stringOut
+func ForJsonOrString(status int, jsonTarget interface{}, stringOut *string) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			if data, err := ioutil.ReadAll(response.HttpResponse.Body); err != nil {
+				return err
+			} else if err := json.Unmarshal(data, jsonTarget); err != nil {
+				*stringOut = string(data)
+			}
+			return nil
+		}
+		return nil
+	}
+}
+
+// ForJsonWithHeaders specify function to handle a specific status returning a parsed json
+// and copying the mapped headers into the given pointers
+// Example:
+//			var total string
+//			ForJsonWithHeaders(200, &items, map[string]*string{"X-Total-Count": &total})
+func ForJsonWithHeaders(status int, body interface{}, headerMap map[string]*string) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			for k, v := range headerMap {
+				*v = response.HttpResponse.Header.Get(k)
+			}
+			if data, err := ioutil.ReadAll(response.HttpResponse.Body); err != nil {
+				return err
+			} else {
+				return json.Unmarshal(data, body)
+			}
+		}
+		return nil
+	}
+}
+
+// ForTypedError specify function to handle a specific status decoding the json body into a T and returning it as the error
+// It allows the callers to recover the error with errors.As
+// Example:
+//		type ApiError struct {
+//			Message string `json:"message"`
+//		}
+//		func (e *ApiError) Error() string { return e.Message }
+//		...
+//		responder, _ := NewResponder(ForTypedError[*ApiError](422))
+//		err := responder.Respond(resp)
+//		var apiErr *ApiError
+//		if errors.As(err, &apiErr) {
+//			...
+//		}
+func ForTypedError[T error](status int) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			var e T
+			if data, err := ioutil.ReadAll(response.HttpResponse.Body); err != nil {
+				return err
+			} else if err := json.Unmarshal(data, &e); err != nil {
+				return err
+			}
+			// a null body leaves a nil pointer, that would panic when its Error is called
+			if isNil(e) {
+				return fmt.Errorf("response: decoded a nil %T for status %d", e, status)
+			}
+			return e
+		}
+		return nil
+	}
+}
+
+// isNil tells if v is nil, including a nil pointer, map or slice inside the interface
+func isNil(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// Into specify function to handle a specific status returning a parsed json into a T
+// It returns the option and the pointer where the body is decoded, read after Respond
+// Each response is decoded into a fresh T
+// Example:
+//		forUser, user := Into[User](200)
+//		responder, _ := NewResponder(forUser)
+//		if err := responder.Respond(resp); err == nil {
+//			fmt.Println(user.Name)
+//		}
+func Into[T any](status int) (Option, *T) {
+	out := new(T)
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			var v T
+			if data, err := ioutil.ReadAll(response.HttpResponse.Body); err != nil {
+				return err
+			} else if err := json.Unmarshal(data, &v); err != nil {
+				return err
+			}
+			*out = v
+			return nil
+		}
+		return nil
+	}, out
+}
+
+// ForProto specify function to handle a specific status returning a parsed protobuf
+// The unmarshal function is injected, so the package does not depend on a protobuf library
+// The Content-Type of the response must be application/x-protobuf
+// Example:
+//		var user pb.User
+//		ForProto[proto.Message](200, &user, proto.Unmarshal)
+func ForProto[M any](status int, msg M, unmarshal func([]byte, M) error) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			ct := response.HttpResponse.Header.Get("Content-Type")
+			if mediaType, _, err := mime.ParseMediaType(ct); err != nil || mediaType != "application/x-protobuf" {
+				return fmt.Errorf("response: expected content type application/x-protobuf, got %q", ct)
+			}
 			if data, err := ioutil.ReadAll(response.HttpResponse.Body); err != nil {
 				return err
 			} else {
-				return xml.Unmarshal(data, int)
+				return unmarshal(data, msg)
+			}
+		}
+		return nil
+	}
+}
+
+// ForXml specify function to handle a specific status returning a parsed xml
+func ForXml(status int, int interface{}) Option {
+	return func(r *Responder) error {
+		r.responders[status] = func(response Response) error {
+			data, converted, err := response.readBody()
+			if err != nil {
+				return err
+			}
+			decoder := xml.NewDecoder(bytes.NewReader(data))
+			decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+				if converted {
+					return input, nil
+				}
+				if response.charsetDecoder == nil {
+					return nil, fmt.Errorf("response: no charset decoder for %s", charset)
+				}
+				return response.charsetDecoder(strings.ToLower(charset), input)
 			}
+			return decoder.Decode(int)
 		}
 		return nil
 	}
@@ -5,9 +5,15 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewResponder(t *testing.T) {
@@ -79,6 +85,205 @@ func TestNewResponderForStatus(t *testing.T) {
 	}
 }
 
+func TestNewResponderForEmpty(t *testing.T) {
+	r, err := NewResponder(ForEmpty(204))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 204, Body: ioutil.NopCloser(bytes.NewBufferString(""))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForEmptyError(t *testing.T) {
+	r, err := NewResponder(ForEmpty(204))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 204, Body: ioutil.NopCloser(bytes.NewBufferString("unexpected"))})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForMeta(t *testing.T) {
+	var meta ResponseMeta
+	r, err := NewResponder(ForMeta(200, &meta))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := ResponseMeta{StatusCode: 200, Status: "200 OK", Proto: "HTTP/1.1", ContentLength: 10}
+	err = r.Respond(&http.Response{
+		StatusCode:    expected.StatusCode,
+		Status:        expected.Status,
+		Proto:         expected.Proto,
+		ContentLength: expected.ContentLength,
+	})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if meta != expected {
+		t.Errorf("meta does not match: expected %+v, result: %+v", expected, meta)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForRedirectLocation(t *testing.T) {
+	var location string
+	r, err := NewResponder(ForRedirectLocation(&location))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://my.host.com/old/path", nil)
+	err = r.Respond(&http.Response{StatusCode: 302, Header: http.Header{"Location": {"../new/path?q=1"}}, Request: req})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := "https://my.host.com/new/path?q=1"
+	if location != expected {
+		t.Errorf("location does not match: expected %s, result: %s", expected, location)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForRedirectLocationError(t *testing.T) {
+	var location string
+	r, err := NewResponder(ForRedirectLocation(&location))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 301})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForRedirectLocationNotModified(t *testing.T) {
+	var location string
+	r, err := NewResponder(ForStatus(304), ForRedirectLocation(&location))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 304})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForRedirectLocationKeepHandler(t *testing.T) {
+	var location string
+	r, err := NewResponder(ForStatus(302), ForRedirectLocation(&location))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 302, Header: http.Header{"Location": {"https://my.host.com/new"}}})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if location != "" {
+		t.Errorf("location does not match: expected %s, result: %s", "", location)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForPreconditionFailed(t *testing.T) {
+	var ok bool
+	r, err := NewResponder(ForPreconditionFailed(func() {
+		ok = true
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	_ = r.Respond(&http.Response{StatusCode: 412})
+	if !ok {
+		t.Error("error using precondition failed handler")
+		t.FailNow()
+	}
+}
+
+func TestChain(t *testing.T) {
+	var handled string
+	first, err := NewResponder(For(200, func(response Response) error {
+		handled = "first"
+		return nil
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	second, err := NewResponder(For(404, func(response Response) error {
+		handled = "second"
+		return nil
+	}), For(200, func(response Response) error {
+		handled = "second 200"
+		return nil
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	r := Chain(first, second)
+
+	_ = r.Respond(&http.Response{StatusCode: 200})
+	if handled != "first" {
+		t.Errorf("handler does not match: expected %s, result: %s", "first", handled)
+		t.FailNow()
+	}
+	_ = r.Respond(&http.Response{StatusCode: 404})
+	if handled != "second" {
+		t.Errorf("handler does not match: expected %s, result: %s", "second", handled)
+		t.FailNow()
+	}
+	if err := r.Respond(&http.Response{StatusCode: 500}); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+func TestChainError(t *testing.T) {
+	var ok bool
+	first, err := NewResponder(For(200, func(response Response) error {
+		return errors.New("mocked error")
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	second, err := NewResponder(ForDefault(func(response Response) error {
+		ok = true
+		return nil
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	r := Chain(first, second)
+	if err := r.Respond(&http.Response{StatusCode: 200}); err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+	if ok {
+		t.Error("second responder should not be consulted")
+		t.FailNow()
+	}
+}
+
 func TestNewResponderForString(t *testing.T) {
 	var resp string
 	r, err := NewResponder(ForString(200, &resp))
@@ -87,18 +292,522 @@ func TestNewResponderForString(t *testing.T) {
 		t.FailNow()
 	}
 
-	_ = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString("name field"))})
-	if resp != "name field" {
-		t.Error("error using string responder")
+	_ = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString("name field"))})
+	if resp != "name field" {
+		t.Error("error using string responder")
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	r, err := NewResponder(ForWriter(200, buf))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	_ = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString("name field"))})
+	if buf.String() != "name field" {
+		t.Error("error using writer responder")
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForSSE(t *testing.T) {
+	var events []string
+	r, err := NewResponder(ForSSE(200, func(event, data string) error {
+		events = append(events, event+"="+data)
+		return nil
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	body := ": comment\n\nevent: update\ndata: line1\ndata: line2\n\ndata:plain\nid: 2\n\ndata: incomplete"
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := []string{"update=line1\nline2", "message=plain"}
+	if len(events) != len(expected) || events[0] != expected[0] || events[1] != expected[1] {
+		t.Errorf("events does not match: expected %q, result: %q", expected, events)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForSSEError(t *testing.T) {
+	r, err := NewResponder(ForSSE(200, func(event, data string) error {
+		return errors.New("mocked error")
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString("data: a\n\n"))})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForLinks(t *testing.T) {
+	var links map[string]string
+	r, err := NewResponder(ForLinks(&links), ForStatus(200))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	header := http.Header{}
+	header.Add("Link", `<https://host/items?page=2&size=10>; rel="next", <https://host/items?page=5>; title="a;b, c"; rel=last`)
+	header.Add("Link", `<https://host/items?page=1>; rel="first prev"`)
+	err = r.Respond(&http.Response{StatusCode: 200, Header: header})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := map[string]string{
+		"next":  "https://host/items?page=2&size=10",
+		"last":  "https://host/items?page=5",
+		"first": "https://host/items?page=1",
+		"prev":  "https://host/items?page=1",
+	}
+	if len(links) != len(expected) {
+		t.Errorf("links does not match: expected %v, result: %v", expected, links)
+		t.FailNow()
+	}
+	for rel, u := range expected {
+		if links[rel] != u {
+			t.Errorf("link %s does not match: expected %s, result: %s", rel, u, links[rel])
+			t.FailNow()
+		}
+	}
+}
+
+func TestNewResponderWithSLA(t *testing.T) {
+	breached := false
+	r, err := NewResponder(WithSLA(time.Second, func(time.Duration) { breached = true }), ForStatus(200))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://host", nil)
+	fast := req.WithContext(ContextWithElapsed(req.Context(), time.Millisecond))
+	_ = r.Respond(&http.Response{StatusCode: 200, Request: fast})
+	if breached {
+		t.Error("fast response should not breach")
+		t.FailNow()
+	}
+	slow := req.WithContext(ContextWithElapsed(req.Context(), 2*time.Second))
+	_ = r.Respond(&http.Response{StatusCode: 200, Request: slow})
+	if !breached {
+		t.Error("slow response should breach")
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForTrailers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(200)
+		_, _ = w.Write([]byte("streamed content"))
+		w.Header().Set("X-Checksum", "abc123")
+	}))
+	defer server.Close()
+
+	var trailers http.Header
+	r, err := NewResponder(ForTrailers(200, &trailers))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := r.Respond(res); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if trailers.Get("X-Checksum") != "abc123" {
+		t.Errorf("trailer does not match: expected %s, result: %s", "abc123", trailers.Get("X-Checksum"))
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForProxy(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	r, err := NewResponder(ForProxy(201, recorder))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Connection", "keep-alive, X-Internal")
+	header.Set("X-Internal", "secret")
+	header.Set("Keep-Alive", "timeout=5")
+	err = r.Respond(&http.Response{StatusCode: 201, Header: header, Body: ioutil.NopCloser(bytes.NewBufferString(`{"id":1}`))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if recorder.Code != 201 {
+		t.Errorf("status does not match: expected %d, result: %d", 201, recorder.Code)
+		t.FailNow()
+	}
+	if recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("header does not match: expected %s, result: %s", "application/json", recorder.Header().Get("Content-Type"))
+		t.FailNow()
+	}
+	for _, h := range []string{"Connection", "X-Internal", "Keep-Alive"} {
+		if recorder.Header().Get(h) != "" {
+			t.Errorf("hop-by-hop header %s should not be copied", h)
+			t.FailNow()
+		}
+	}
+	if recorder.Body.String() != `{"id":1}` {
+		t.Errorf("body does not match: expected %s, result: %s", `{"id":1}`, recorder.Body.String())
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForWhen(t *testing.T) {
+	result := ""
+	resultType := func(value string) func(http.Header) bool {
+		return func(h http.Header) bool { return h.Get("X-Result-Type") == value }
+	}
+	r, err := NewResponder(
+		ForWhen(200, resultType("user"), func(Response) error { result = "user"; return nil }),
+		ForWhen(200, resultType("group"), func(Response) error { result = "group"; return nil }),
+		For(200, func(Response) error { result = "plain"; return nil }),
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	for _, tc := range []struct{ header, expected string }{{"user", "user"}, {"group", "group"}, {"other", "plain"}} {
+		_ = r.Respond(&http.Response{StatusCode: 200, Header: http.Header{"X-Result-Type": {tc.header}}})
+		if result != tc.expected {
+			t.Errorf("handler does not match: expected %s, result: %s", tc.expected, result)
+			t.FailNow()
+		}
+	}
+}
+
+func TestNewResponderForWhenChain(t *testing.T) {
+	result := ""
+	conditional, _ := NewResponder(ForWhen(200, func(h http.Header) bool { return h.Get("X-Cache") == "hit" }, func(Response) error {
+		result = "cached"
+		return nil
+	}))
+	plain, _ := NewResponder(For(200, func(Response) error { result = "plain"; return nil }))
+	r := Chain(conditional, plain)
+	_ = r.Respond(&http.Response{StatusCode: 200, Header: http.Header{}})
+	if result != "plain" {
+		t.Errorf("handler does not match: expected %s, result: %s", "plain", result)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForJson(t *testing.T) {
+	resp := struct {
+		Name string `json:"name"`
+	}{Name: ""}
+	r, err := NewResponder(ForJson(200, &resp))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	marshal, _ := json.Marshal(struct {
+		Name string `json:"name"`
+	}{Name: "name field"})
+	_ = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewReader(marshal))})
+	if resp.Name != "name field" {
+		t.Error("error using json responder")
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForJsonTee(t *testing.T) {
+	resp := struct {
+		Name string `json:"name"`
+	}{}
+	tee := new(bytes.Buffer)
+	r, err := NewResponder(ForJsonTee(200, &resp, tee))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	body := `{"name":"name field"}`
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if resp.Name != "name field" {
+		t.Errorf("name does not match: expected %s, result: %s", "name field", resp.Name)
+		t.FailNow()
+	}
+	if tee.String() != body {
+		t.Errorf("teed body does not match: expected %s, result: %s", body, tee.String())
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForJsonTimeLayout(t *testing.T) {
+	resp := struct {
+		Birthday Time[DateLayout] `json:"birthday"`
+		Deleted  Time[DateLayout] `json:"deleted"`
+	}{}
+	r, err := NewResponder(ForJson(200, &resp))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"birthday":"1990-05-17","deleted":null}`))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	expected := time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC)
+	if !resp.Birthday.Equal(expected) {
+		t.Errorf("birthday does not match: expected %s, result: %s", expected, resp.Birthday.Time)
+		t.FailNow()
+	}
+	if !resp.Deleted.IsZero() {
+		t.Errorf("deleted does not match: expected zero, result: %s", resp.Deleted.Time)
+		t.FailNow()
+	}
+	marshal, _ := json.Marshal(resp.Birthday)
+	if string(marshal) != `"1990-05-17"` {
+		t.Errorf("marshaled time does not match: expected %s, result: %s", `"1990-05-17"`, string(marshal))
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForJsonTimeLayoutError(t *testing.T) {
+	resp := struct {
+		Birthday Time[DateLayout] `json:"birthday"`
+	}{}
+	r, err := NewResponder(ForJson(200, &resp))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"birthday":"17/05/1990"}`))})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForJsonRaw(t *testing.T) {
+	resp := struct {
+		Name string `json:"name"`
+	}{}
+	var raw []byte
+	r, err := NewResponder(ForJsonRaw(200, &resp, &raw))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	body := `{"name": "name field", "extra": 1}`
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if resp.Name != "name field" {
+		t.Errorf("name does not match: expected %s, result: %s", "name field", resp.Name)
+		t.FailNow()
+	}
+	if string(raw) != body {
+		t.Errorf("raw body does not match: expected %s, result: %s", body, string(raw))
 		t.FailNow()
 	}
 }
 
-func TestNewResponderForJson(t *testing.T) {
+func TestNewResponderForJsonConcat(t *testing.T) {
+	type elem struct {
+		Name string `json:"name"`
+	}
+	var elems []*elem
+	r, err := NewResponder(ForJsonConcat(200,
+		func() interface{} { return &elem{} },
+		func(v interface{}) { elems = append(elems, v.(*elem)) },
+	))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"name":"a"}{"name":"b"}`))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if len(elems) != 2 || elems[0].Name != "a" || elems[1].Name != "b" {
+		t.Errorf("elements does not match: expected %s, result: %+v", "a and b", elems)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForJsonConcatError(t *testing.T) {
+	r, err := NewResponder(ForJsonConcat(200,
+		func() interface{} { return &struct{}{} },
+		func(v interface{}) {},
+	))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{}{"broken`))})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+type mockedCircle struct {
+	Radius int `json:"radius"`
+}
+
+type mockedSquare struct {
+	Side int `json:"side"`
+}
+
+func TestNewResponderForJsonDiscriminated(t *testing.T) {
+	var shape interface{}
+	r, err := NewResponder(ForJsonDiscriminated(200, "type", func(typeValue string) interface{} {
+		switch typeValue {
+		case "circle":
+			shape = &mockedCircle{}
+		case "square":
+			shape = &mockedSquare{}
+		default:
+			shape = nil
+		}
+		return shape
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"type":"circle","radius":3}`))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if circle, ok := shape.(*mockedCircle); !ok || circle.Radius != 3 {
+		t.Errorf("shape does not match: expected %s, result: %+v", "circle", shape)
+		t.FailNow()
+	}
+
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"type":"square","side":4}`))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if square, ok := shape.(*mockedSquare); !ok || square.Side != 4 {
+		t.Errorf("shape does not match: expected %s, result: %+v", "square", shape)
+		t.FailNow()
+	}
+
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"type":"triangle"}`))})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForJsonFactory(t *testing.T) {
+	type user struct {
+		Id int `json:"id"`
+	}
+	var mu sync.Mutex
+	decoded := make(map[int]int)
+	r, err := NewResponder(ForJsonFactory(200,
+		func() interface{} { return &user{} },
+		func(v interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+			decoded[v.(*user).Id]++
+			return nil
+		},
+	))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"id":%d}`, id)
+			_ = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body))})
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 20; i++ {
+		if decoded[i] != 1 {
+			t.Errorf("decoded values does not match: expected %d once, result: %v", i, decoded)
+			t.FailNow()
+		}
+	}
+}
+
+func TestNewResponderForJsonOrString(t *testing.T) {
 	resp := struct {
 		Name string `json:"name"`
 	}{Name: ""}
-	r, err := NewResponder(ForJson(200, &resp))
+	var respStr string
+	r, err := NewResponder(ForJsonOrString(200, &resp, &respStr))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"name":"name field"}`))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if resp.Name != "name field" || respStr != "" {
+		t.Error("error using json or string responder")
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForJsonOrStringFallback(t *testing.T) {
+	resp := struct {
+		Name string `json:"name"`
+	}{Name: ""}
+	var respStr string
+	r, err := NewResponder(ForJsonOrString(200, &resp, &respStr))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString("internal error"))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if respStr != "internal error" {
+		t.Errorf("body does not match: expected %s, result: %s", "internal error", respStr)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForJsonWithHeaders(t *testing.T) {
+	resp := struct {
+		Name string `json:"name"`
+	}{Name: ""}
+	var total string
+	r, err := NewResponder(ForJsonWithHeaders(200, &resp, map[string]*string{"X-Total-Count": &total}))
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
@@ -106,11 +815,74 @@ func TestNewResponderForJson(t *testing.T) {
 	marshal, _ := json.Marshal(struct {
 		Name string `json:"name"`
 	}{Name: "name field"})
-	_ = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewReader(marshal))})
+	header := http.Header{}
+	header.Set("X-Total-Count", "42")
+	err = r.Respond(&http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(bytes.NewReader(marshal))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
 	if resp.Name != "name field" {
 		t.Error("error using json responder")
 		t.FailNow()
 	}
+	if total != "42" {
+		t.Errorf("header does not match: expected %s, result: %s", "42", total)
+		t.FailNow()
+	}
+}
+
+// mockedMessage is a fake protobuf message, encoded as "name:<Name>"
+type mockedMessage struct {
+	Name string
+}
+
+func unmarshalMockedMessage(data []byte, m *mockedMessage) error {
+	if !strings.HasPrefix(string(data), "name:") {
+		return errors.New("invalid message")
+	}
+	m.Name = strings.TrimPrefix(string(data), "name:")
+	return nil
+}
+
+func TestNewResponderForProto(t *testing.T) {
+	var msg mockedMessage
+	r, err := NewResponder(ForProto(200, &msg, unmarshalMockedMessage))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": {"application/x-protobuf"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString("name:myName")),
+	})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if msg.Name != "myName" {
+		t.Errorf("name does not match: expected %s, result: %s", "myName", msg.Name)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForProtoContentTypeError(t *testing.T) {
+	var msg mockedMessage
+	r, err := NewResponder(ForProto(200, &msg, unmarshalMockedMessage))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString("name:myName")),
+	})
+	if err == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
 }
 
 func TestNewResponderForXml(t *testing.T) {
@@ -207,6 +979,141 @@ func TestNewResponderForXmlError(t *testing.T) {
 	}
 }
 
+func latin1Decoder(charset string, r io.Reader) (io.Reader, error) {
+	if charset != "iso-8859-1" {
+		return nil, errors.New("unsupported charset")
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return strings.NewReader(string(runes)), nil
+}
+
+func TestNewResponderForStringCharset(t *testing.T) {
+	var resp string
+	r, err := NewResponder(WithCharsetDecoder(latin1Decoder), ForString(200, &resp))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=ISO-8859-1")
+	err = r.Respond(&http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(bytes.NewReader([]byte{'c', 'a', 'f', 0xe9}))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if resp != "café" {
+		t.Errorf("body does not match: expected %s, result: %s", "café", resp)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForXmlCharset(t *testing.T) {
+	resp := struct {
+		XMLName xml.Name `xml:"obj"`
+		Name    string   `xml:"name"`
+	}{Name: ""}
+	r, err := NewResponder(WithCharsetDecoder(latin1Decoder), ForXml(200, &resp))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	body := append([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?><obj><name>caf`), 0xe9)
+	body = append(body, []byte(`</name></obj>`)...)
+	header := http.Header{}
+	header.Set("Content-Type", "text/xml; charset=ISO-8859-1")
+	err = r.Respond(&http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(bytes.NewReader(body))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if resp.Name != "café" {
+		t.Errorf("body does not match: expected %s, result: %s", "café", resp.Name)
+		t.FailNow()
+	}
+}
+
+type mockedApiError struct {
+	Message string `json:"message"`
+}
+
+func (e *mockedApiError) Error() string {
+	return e.Message
+}
+
+func TestNewResponderInto(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+	forUser, u := Into[user](200)
+	r, err := NewResponder(forUser)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{"name":"name field"}`))})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if u.Name != "name field" {
+		t.Errorf("name does not match: expected %s, result: %s", "name field", u.Name)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForTypedError(t *testing.T) {
+	r, err := NewResponder(ForTypedError[*mockedApiError](422))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 422, Body: ioutil.NopCloser(bytes.NewBufferString(`{"message":"invalid name"}`))})
+	var apiErr *mockedApiError
+	if !errors.As(err, &apiErr) {
+		t.Errorf("error does not match: expected %T, result: %v", apiErr, err)
+		t.FailNow()
+	}
+	if apiErr.Message != "invalid name" {
+		t.Errorf("error message does not match: expected %s, result: %s", "invalid name", apiErr.Message)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForTypedErrorDecodeError(t *testing.T) {
+	r, err := NewResponder(ForTypedError[*mockedApiError](422))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 422, Body: ioutil.NopCloser(bytes.NewBufferString("not json"))})
+	var apiErr *mockedApiError
+	if err == nil || errors.As(err, &apiErr) {
+		t.Errorf("expected decode error, result: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestNewResponderForTypedErrorNull(t *testing.T) {
+	r, err := NewResponder(ForTypedError[*mockedApiError](422))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = r.Respond(&http.Response{StatusCode: 422, Body: ioutil.NopCloser(bytes.NewBufferString("null"))})
+	var apiErr *mockedApiError
+	if err == nil || errors.As(err, &apiErr) {
+		t.Errorf("expected decode error, result: %v", err)
+		t.FailNow()
+	}
+}
+
 type mockedErrorReadCloser struct {
 }
 
@@ -217,3 +1124,22 @@ func (m mockedErrorReadCloser) Read(_ []byte) (n int, err error) {
 func (m mockedErrorReadCloser) Close() error {
 	return errors.New("expected error")
 }
+
+func TestNewResponderRecoverPanics(t *testing.T) {
+	r, err := NewResponder(RecoverPanics(), For(200, func(response Response) error {
+		panic("mocked panic")
+	}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	errResp := r.Respond(&http.Response{StatusCode: 200})
+	if errResp == nil {
+		t.Error("expected error")
+		t.FailNow()
+	}
+	if !strings.Contains(errResp.Error(), "mocked panic") {
+		t.Errorf("error does not has the panic: result: %s", errResp.Error())
+		t.FailNow()
+	}
+}
@@ -0,0 +1,58 @@
+package response
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TimeLayout provides the layout of a Time
+// Example:
+//		type BrazilianDate struct{}
+//
+//		func (BrazilianDate) Layout() string { return "02/01/2006" }
+type TimeLayout interface {
+	Layout() string
+}
+
+// DateLayout is the TimeLayout of dates like 2006-01-02
+type DateLayout struct{}
+
+func (DateLayout) Layout() string {
+	return "2006-01-02"
+}
+
+// Time is a time.Time decoded from, and encoded to, a json string with the layout of L
+// Useful for APIs with timestamps that are not RFC3339
+// A json null keeps the zero time
+// Example:
+//		type User struct {
+//			Name     string                              `json:"name"`
+//			Birthday response.Time[response.DateLayout] `json:"birthday"`
+//		}
+//		...
+//		user.Birthday.Year()
+type Time[L TimeLayout] struct {
+	time.Time
+}
+
+func (t *Time[L]) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	var layout L
+	parsed, err := time.Parse(layout.Layout(), s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+func (t Time[L]) MarshalJSON() ([]byte, error) {
+	var layout L
+	return json.Marshal(t.Time.Format(layout.Layout()))
+}